@@ -0,0 +1,153 @@
+// Package cdc splits files into content defined chunks with FastCDC, so
+// files sharing most of their content share most of their chunks even if
+// the shared parts are at different offsets
+package cdc
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"math/bits"
+)
+
+// DefaultAverageSize is the default average size of the chunks
+const DefaultAverageSize = 64 * 1024
+
+// Chunk is a content defined part of a file
+type Chunk struct {
+	Offset int64
+	Size   int
+	// SHA-256 of the chunk, hex encoded
+	Hash string
+}
+
+// gear maps bytes to random values for the rolling hash. The values must
+// never change, or chunks of already scanned files won't match new ones.
+var gear [256]uint64
+
+func init() {
+	// splitmix64 with a fixed seed
+	seed := uint64(0x676f6475706563dc)
+	for i := range gear {
+		seed += 0x9e3779b97f4a7c15
+		z := seed
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		gear[i] = z ^ (z >> 31)
+	}
+}
+
+// Writer splits the data written to it into chunks. Cut points only depend
+// on the data, not on how it's split into writes, so a Writer can chunk a
+// file while it's being read for something else.
+type Writer struct {
+	buf []byte
+	// data in buf not in a chunk yet starts here
+	start int
+	// offset of the next chunk in the stream
+	offset int64
+	chunks []Chunk
+
+	min, avg, max int
+	// The hash needs more matching bits before the average size is reached,
+	// which keeps the chunk sizes close to the average
+	maskS, maskL uint64
+}
+
+// NewWriter creates a Writer with the given average chunk size, rounded to a
+// power of two. Chunks are from a quarter to eight times the average size.
+func NewWriter(avgSize int) *Writer {
+	if avgSize < 256 {
+		avgSize = DefaultAverageSize
+	}
+	n := bits.Len(uint(avgSize)) - 1
+	avg := 1 << n
+
+	return &Writer{
+		min: avg / 4,
+		avg: avg,
+		max: avg * 8,
+		// The top bits depend on the last 64 bytes
+		maskS: ^uint64(0) << (64 - (n + 2)),
+		maskL: ^uint64(0) << (64 - (n - 2)),
+	}
+}
+
+// cut returns the length of the next chunk in data
+func (w *Writer) cut(data []byte) int {
+	n := len(data)
+	if n <= w.min {
+		return n
+	}
+	if n > w.max {
+		n = w.max
+	}
+	normal := w.avg
+	if normal > n {
+		normal = n
+	}
+
+	var fp uint64
+	i := w.min
+	for ; i < normal; i++ {
+		fp = (fp << 1) + gear[data[i]]
+		if fp&w.maskS == 0 {
+			return i + 1
+		}
+	}
+	for ; i < n; i++ {
+		fp = (fp << 1) + gear[data[i]]
+		if fp&w.maskL == 0 {
+			return i + 1
+		}
+	}
+	return n
+}
+
+// split cuts chunks from the buffered data while at least min bytes, at least one, are left
+func (w *Writer) split(min int) {
+	for len(w.buf)-w.start >= min {
+		data := w.buf[w.start:]
+		n := w.cut(data)
+		w.chunks = append(w.chunks, Chunk{Offset: w.offset, Size: n, Hash: fmt.Sprintf("%x", sha256.Sum256(data[:n]))})
+		w.start += n
+		w.offset += int64(n)
+	}
+}
+
+// Write adds data to the stream, it never fails
+func (w *Writer) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+
+	// The next cut point is known once there's a max size chunk of data
+	w.split(w.max)
+
+	if w.start >= w.max {
+		w.buf = w.buf[:copy(w.buf, w.buf[w.start:])]
+		w.start = 0
+	}
+	return len(p), nil
+}
+
+// Close cuts the rest of the data into chunks at the end of the stream
+func (w *Writer) Close() error {
+	w.split(1)
+	w.buf = nil
+	w.start = 0
+	return nil
+}
+
+// Chunks returns the chunks of the stream, call Close first to include the end of the stream
+func (w *Writer) Chunks() []Chunk {
+	return w.chunks
+}
+
+// All returns all chunks of a stream
+func All(r io.Reader, avgSize int) ([]Chunk, error) {
+	w := NewWriter(avgSize)
+	if _, err := io.Copy(w, r); err != nil {
+		return nil, err
+	}
+	w.Close()
+	return w.Chunks(), nil
+}
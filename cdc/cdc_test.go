@@ -0,0 +1,108 @@
+package cdc
+
+import (
+	"bytes"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+// randomData returns n pseudo-random bytes, the same for the same seed
+func randomData(seed int64, n int) []byte {
+	data := make([]byte, n)
+	rand.New(rand.NewSource(seed)).Read(data)
+	return data
+}
+
+func TestChunkBounds(t *testing.T) {
+	const avg = 4096
+	data := randomData(1, 1<<20)
+
+	chunks, err := All(bytes.NewReader(data), avg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chunks) < 2 {
+		t.Fatalf("got %d chunks, want many", len(chunks))
+	}
+
+	var offset int64
+	for i, c := range chunks {
+		if c.Offset != offset {
+			t.Errorf("chunk %d at offset %d, want %d", i, c.Offset, offset)
+		}
+		// The last chunk is whatever is left
+		if i < len(chunks)-1 && (c.Size < avg/4 || c.Size > avg*8) {
+			t.Errorf("chunk %d is %d bytes, want %d to %d", i, c.Size, avg/4, avg*8)
+		}
+		offset += int64(c.Size)
+	}
+	if offset != int64(len(data)) {
+		t.Errorf("chunks cover %d bytes, want %d", offset, len(data))
+	}
+}
+
+func TestWriteSizes(t *testing.T) {
+	data := randomData(2, 300000)
+
+	want, err := All(bytes.NewReader(data), 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, size := range []int{1, 7, 1000, 8192, 100000} {
+		w := NewWriter(1024)
+		for p := data; len(p) > 0; {
+			n := size
+			if n > len(p) {
+				n = len(p)
+			}
+			w.Write(p[:n])
+			p = p[n:]
+		}
+		w.Close()
+
+		if !reflect.DeepEqual(w.Chunks(), want) {
+			t.Errorf("writes of %d bytes: chunks differ from a single read", size)
+		}
+	}
+}
+
+func TestInsertKeepsChunks(t *testing.T) {
+	data := randomData(3, 1<<20)
+	inserted := append(append(append([]byte{}, data[:500000]...), randomData(4, 100)...), data[500000:]...)
+
+	a, err := All(bytes.NewReader(data), 4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := All(bytes.NewReader(inserted), 4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hashes := map[string]bool{}
+	for _, c := range a {
+		hashes[c.Hash] = true
+	}
+	shared := 0
+	for _, c := range b {
+		if hashes[c.Hash] {
+			shared++
+		}
+	}
+	// Only the chunks around the inserted bytes change
+	if shared < len(a)-4 {
+		t.Errorf("%d of %d chunks shared after an insert", shared, len(a))
+	}
+}
+
+func TestEmpty(t *testing.T) {
+	chunks, err := All(bytes.NewReader(nil), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chunks) != 0 {
+		t.Errorf("got %d chunks for no data", len(chunks))
+	}
+}
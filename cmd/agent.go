@@ -0,0 +1,85 @@
+/*
+Copyright © 2026 Riku Lindblad <riku.lindblad@iki.fi>
+*/
+package cmd
+
+import (
+	"net"
+	"os"
+
+	"github.com/lepinkainen/godupe/godupe"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// agentCmd represents the agent command
+var agentCmd = &cobra.Command{
+	Use:   "agent [directory]",
+	Args:  cobra.ExactArgs(1),
+	Short: "Hash files for a DB on another machine",
+	Long: `Hash all files under the directory where the disk is and stream the
+results as newline delimited JSON, one object per file:
+
+  {"path":"/srv/img.jpg","size":1234,"mtime":1700000000000000000,"hash":"..."}
+
+Nothing is stored on this machine. The results are written to stdout, or
+with --listen to every controller connecting to the address. Load them
+to the DB on the other machine with ingest:
+
+  ssh nas godupe agent /srv | godupe ingest --volume nas
+  godupe ingest --volume nas nas:7070
+
+The TCP listener has no authentication or encryption, only use it on
+trusted networks.`,
+	Run: agent,
+}
+
+func init() {
+	rootCmd.AddCommand(agentCmd)
+
+	agentCmd.Flags().BoolP("partial", "p", false, "Only read the first X MiB of a file to generate a partial hash")
+	agentCmd.Flags().Int64("limit", 2, "Amount of MiB to read when doing partial scan")
+	agentCmd.Flags().String("listen", "", "Address to stream the results to controllers from, e.g. :7070")
+}
+
+func agent(cmd *cobra.Command, args []string) {
+	viper.AutomaticEnv()
+
+	viper.BindPFlag("partial", cmd.Flags().Lookup("partial"))
+	viper.BindPFlag("limit", cmd.Flags().Lookup("limit"))
+	viper.BindPFlag("listen", cmd.Flags().Lookup("listen"))
+
+	root := args[0]
+	hasher := newHasher()
+
+	if viper.GetString("listen") == "" {
+		err := godupe.StreamRecords(os.Stdout, root, hasher)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	l, err := net.Listen("tcp", viper.GetString("listen"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Infof("Streaming %s to controllers connecting to %s", root, l.Addr())
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			log.Fatal(err)
+		}
+		go func() {
+			defer conn.Close()
+			log.Infof("Streaming to %s", conn.RemoteAddr())
+			if err := godupe.StreamRecords(conn, root, hasher); err != nil {
+				log.Errorf("Error streaming to %s: %s", conn.RemoteAddr(), err)
+				return
+			}
+			log.Infof("Done streaming to %s", conn.RemoteAddr())
+		}()
+	}
+}
@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lepinkainen/godupe/godupe"
+)
+
+// runCommand runs the command line with stdin read from the file in and
+// returns what was written to stdout
+func runCommand(t *testing.T, in string, args ...string) string {
+	out, err := os.CreateTemp(t.TempDir(), "stdout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+
+	oldStdin, oldStdout := os.Stdin, os.Stdout
+	defer func() { os.Stdin, os.Stdout = oldStdin, oldStdout }()
+	os.Stdout = out
+	if in != "" {
+		f, err := os.Open(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		os.Stdin = f
+	}
+
+	rootCmd.SetArgs(args)
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(out.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestAgentIngest(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{"a.txt": "first", "sub/b.txt": "second"}
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A config file in use must not end up in the streamed results
+	cfg := filepath.Join(t.TempDir(), "godupe.yaml")
+	if err := os.WriteFile(cfg, []byte("log-level: info\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cfgFile = "" })
+
+	oldStore, oldVolumes := store, volumes
+	t.Cleanup(func() { store, volumes = oldStore, oldVolumes })
+
+	records := filepath.Join(t.TempDir(), "records.json")
+	out := runCommand(t, "", "--config", cfg, "agent", dir)
+	if err := os.WriteFile(records, []byte(out), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(out, "\n"); lines != len(files) {
+		t.Fatalf("agent wrote %d lines, want %d:\n%s", lines, len(files), out)
+	}
+
+	db := filepath.Join(t.TempDir(), "test.db")
+	out = runCommand(t, records, "--config", cfg, "ingest", "--db", db, "--volume", "nas")
+	if !strings.Contains(out, "Ingested 2 files on volume nas") {
+		t.Errorf("ingest output = %q", out)
+	}
+
+	s, err := godupe.OpenStore(godupe.StoreOptions{Path: db})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	for name := range files {
+		path := "nas:" + filepath.ToSlash(filepath.Join(dir, name))
+		if e, ok, err := s.Lookup(path); err != nil || !ok || e.Hash == "" {
+			t.Errorf("Lookup(%s) = %+v, %v, %v", path, e, ok, err)
+		}
+	}
+}
@@ -16,9 +16,14 @@ import (
 
 // checkCmd represents the check command
 var checkCmd = &cobra.Command{
-	Use:   "check",
+	Use:   "check [directory]",
+	Args:  cobra.MinimumNArgs(1),
 	Short: "Check the given tree for existing files",
-	Run:   check,
+	Long: `Check the given tree for files that are already in the DB.
+
+By default files are looked up by path. With --by-content each file
+is hashed and looked up by its hash, so copies in other locations are found.`,
+	Run: check,
 }
 
 func init() {
@@ -33,25 +38,12 @@ func init() {
 	// Cobra supports local flags which will only run when this command
 	// is called directly, e.g.:
 	// checkCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
-	// Get user's configuration directory
-	configDir, err := os.UserConfigDir()
-	if err != nil {
-		fmt.Println("Error getting configuration directory:", err)
-		return
-	}
-
-	// Create the godupe directory if it doesn't exist
-	godupeDir := filepath.Join(configDir, "godupe")
-	err = os.MkdirAll(godupeDir, os.ModePerm)
-	if err != nil {
-		fmt.Println("Error creating directory:", err)
-		return
-	}
-
-	// Construct the full path to the database file
-	dbPath := filepath.Join(godupeDir, "godupe.db")
+	dbPath := defaultDBPath()
 
 	checkCmd.Flags().String("db", dbPath, "DB file to use")
+	checkCmd.Flags().Bool("by-content", false, "Find files by content instead of path")
+	checkCmd.Flags().BoolP("partial", "p", false, "Only read the first X MiB of a file to generate a partial hash")
+	checkCmd.Flags().Int64("limit", 2, "Amount of MiB to read when doing partial scan")
 }
 
 func checkWalkFunc(path string, info os.FileInfo, err error) error {
@@ -72,7 +64,10 @@ func checkWalkFunc(path string, info os.FileInfo, err error) error {
 	// TODO: maybe load the full list of stuff to memory to speed up the process?
 	// Benchmark it?
 	absfilepath, _ := filepath.Abs(path)
-	res := db.Exists(absfilepath)
+	res, err := store.Exists(volumes.DBPath(absfilepath))
+	if err != nil {
+		log.Fatal(err)
+	}
 	if res == db.HashTypeNotExist {
 		fmt.Printf("Not found: %s\n", path)
 		return nil
@@ -82,17 +77,76 @@ func checkWalkFunc(path string, info os.FileInfo, err error) error {
 	return nil
 }
 
+func checkContentWalkFunc(path string, info os.FileInfo, err error) error {
+	// handle situations when a file isn't really a file or directory
+	// usually files with really weird filenames on network drives
+	defer func() {
+		if x := recover(); x != nil {
+			log.Errorf("Unreadable file: %s\n", path)
+			log.Errorf("Recovered in %s", x)
+		}
+	}()
+
+	if err != nil {
+		log.Errorf("Error walking directory: %s\n", path)
+		return err
+	}
+
+	// We can't do anything to directories
+	if !info.Mode().IsRegular() {
+		return nil
+	}
+
+	// No file of this size in the DB, no need to hash it
+	exists, err := store.SizeExists(info.Size())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if !exists {
+		fmt.Printf("Not found: %s\n", path)
+		return nil
+	}
+
+	_, size, hash, err := newHasher().HashFile(path, nil)
+	if err != nil {
+		log.Errorf("Error hashing file %s: %s\n", path, err)
+		return nil
+	}
+
+	copies, err := store.FindByHash(hash, size, viper.GetBool("partial"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(copies) == 0 {
+		fmt.Printf("Not found: %s\n", path)
+		return nil
+	}
+
+	fmt.Printf("Found: %s\n", path)
+	for _, c := range copies {
+		fmt.Printf("  -> %s\n", c)
+	}
+
+	return nil
+}
+
 func check(cmd *cobra.Command, args []string) {
 	viper.AutomaticEnv()
 
 	viper.BindPFlag("db", cmd.Flags().Lookup("db"))
-
-	if viper.GetBool("verbose") {
-		log.SetLevel(log.DebugLevel)
-	}
+	viper.BindPFlag("by-content", cmd.Flags().Lookup("by-content"))
+	viper.BindPFlag("partial", cmd.Flags().Lookup("partial"))
+	viper.BindPFlag("limit", cmd.Flags().Lookup("limit"))
 
 	log.Infof("Using database %s\n", viper.GetString("db"))
 
-	db.Init()
+	openStore()
+	defer store.Close()
+
+	if viper.GetBool("by-content") {
+		filepath.Walk(args[0], checkContentWalkFunc)
+		return
+	}
+
 	filepath.Walk(args[0], checkWalkFunc)
 }
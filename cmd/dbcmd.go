@@ -0,0 +1,18 @@
+/*
+Copyright © 2026 Riku Lindblad <riku.lindblad@iki.fi>
+*/
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// dbCmd groups the commands maintaining the DB itself
+var dbCmd = &cobra.Command{
+	Use:   "db",
+	Short: "Maintain the DB",
+}
+
+func init() {
+	rootCmd.AddCommand(dbCmd)
+}
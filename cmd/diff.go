@@ -0,0 +1,195 @@
+/*
+Copyright © 2026 Riku Lindblad <riku.lindblad@iki.fi>
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/lepinkainen/godupe/file"
+	"github.com/lepinkainen/godupe/godupe"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// diffCmd represents the diff command
+var diffCmd = &cobra.Command{
+	Use:   "diff [A] [B]",
+	Args:  cobra.ExactArgs(2),
+	Short: "Compare the contents of two directory trees",
+	Long: `Compare two directory trees by file content.
+
+Reports files that only exist in A, files that only exist in B
+and files that exist in both, but under a different path.
+Both trees are scanned first so the DB is up to date.`,
+	Run: diff,
+}
+
+func init() {
+	rootCmd.AddCommand(diffCmd)
+
+	dbPath := defaultDBPath()
+
+	diffCmd.Flags().String("db", dbPath, "DB file to use")
+	diffCmd.Flags().Bool("scan", true, "Scan both trees before comparing")
+	diffCmd.Flags().String("format", "text", "Output format: text or json")
+}
+
+// movedFile is a file that exists in both trees with different relative paths
+type movedFile struct {
+	Hash string   `json:"hash"`
+	A    string   `json:"a"`
+	B    []string `json:"b"`
+}
+
+// diffResult is the comparison of two trees, paths are relative to the tree roots
+type diffResult struct {
+	A     string      `json:"a"`
+	B     string      `json:"b"`
+	OnlyA []string    `json:"only_a"`
+	OnlyB []string    `json:"only_b"`
+	Moved []movedFile `json:"moved"`
+	Same  int         `json:"same"`
+}
+
+// hashesByPath returns the relative paths of all fully hashed files under root, grouped by hash
+func hashesByPath(root string) map[string][]string {
+	hashes := map[string][]string{}
+
+	entries, err := store.Tree(root)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, e := range entries {
+		if e.Hash == "" {
+			log.Warnf("No full hash for %s, skipping", e.Path)
+			continue
+		}
+		rel, err := filepath.Rel(root, e.Path)
+		if err != nil {
+			log.Errorf("Error getting relative path for %s: %s\n", e.Path, err)
+			continue
+		}
+		hashes[e.Hash] = append(hashes[e.Hash], rel)
+	}
+
+	return hashes
+}
+
+// compareTrees compares the stored hashes of two trees
+func compareTrees(a, b string) diffResult {
+	res := diffResult{A: a, B: b, OnlyA: []string{}, OnlyB: []string{}, Moved: []movedFile{}}
+
+	hashesA := hashesByPath(a)
+	hashesB := hashesByPath(b)
+
+	for hash, pathsA := range hashesA {
+		pathsB, ok := hashesB[hash]
+		if !ok {
+			res.OnlyA = append(res.OnlyA, pathsA...)
+			continue
+		}
+
+		for _, pathA := range pathsA {
+			if contains(pathsB, pathA) {
+				res.Same++
+				continue
+			}
+			res.Moved = append(res.Moved, movedFile{Hash: hash, A: pathA, B: pathsB})
+		}
+	}
+
+	for hash, pathsB := range hashesB {
+		if _, ok := hashesA[hash]; !ok {
+			res.OnlyB = append(res.OnlyB, pathsB...)
+		}
+	}
+
+	sort.Strings(res.OnlyA)
+	sort.Strings(res.OnlyB)
+	sort.Slice(res.Moved, func(i, j int) bool { return res.Moved[i].A < res.Moved[j].A })
+
+	return res
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func printDiff(res diffResult, format string) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(res)
+	case "text":
+		for _, path := range res.OnlyA {
+			fmt.Printf("Only in %s: %s\n", res.A, path)
+		}
+		for _, path := range res.OnlyB {
+			fmt.Printf("Only in %s: %s\n", res.B, path)
+		}
+		for _, m := range res.Moved {
+			fmt.Printf("Moved: %s -> %v\n", m.A, m.B)
+		}
+		fmt.Printf("%d only in A, %d only in B, %d moved, %d identical\n", len(res.OnlyA), len(res.OnlyB), len(res.Moved), res.Same)
+		return nil
+	default:
+		return fmt.Errorf("unknown format: %s", format)
+	}
+}
+
+func diff(cmd *cobra.Command, args []string) {
+	viper.AutomaticEnv()
+
+	viper.BindPFlag("db", cmd.Flags().Lookup("db"))
+	viper.BindPFlag("scan", cmd.Flags().Lookup("scan"))
+	viper.BindPFlag("format", cmd.Flags().Lookup("format"))
+
+	log.Infof("Using database %s\n", viper.GetString("db"))
+
+	openStore()
+	defer store.Close()
+
+	var roots []string
+	for _, arg := range args {
+		// Trees on other volumes can only be compared as stored
+		if _, _, ok := file.SplitVolumePath(arg); ok {
+			roots = append(roots, arg)
+			continue
+		}
+
+		root, err := filepath.Abs(arg)
+		if err != nil {
+			log.Fatalf("Error getting absolute path for %s: %s\n", arg, err)
+		}
+		if viper.GetBool("scan") {
+			// Content is compared by full hash, a partial hash isn't enough
+			scanner, err := godupe.NewScanner(godupe.ScannerOptions{Store: store, Volumes: volumes})
+			if err != nil {
+				log.Fatal(err)
+			}
+			// Comparing stale hashes would report the wrong differences
+			if err := scanner.Scan(root); err != nil {
+				log.Fatalf("Error scanning %s: %s\n", root, err)
+			}
+		}
+
+		roots = append(roots, volumes.DBPath(root))
+	}
+
+	err := printDiff(compareTrees(roots[0], roots[1]), viper.GetString("format"))
+	if err != nil {
+		log.Fatal(err)
+	}
+}
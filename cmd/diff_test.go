@@ -0,0 +1,31 @@
+package cmd
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCompareTrees(t *testing.T) {
+	dir := scanTemp(t, map[string]string{
+		"a/same":      "same",
+		"a/moved":     "moved",
+		"a/only":      "only in a",
+		"b/same":      "same",
+		"b/sub/moved": "moved",
+		"b/only":      "only in b",
+	})
+	a, b := filepath.Join(dir, "a"), filepath.Join(dir, "b")
+
+	res := compareTrees(a, b)
+
+	if want := []string{"only"}; !reflect.DeepEqual(res.OnlyA, want) || !reflect.DeepEqual(res.OnlyB, want) {
+		t.Errorf("only in A %v and B %v, want %v in both", res.OnlyA, res.OnlyB, want)
+	}
+	if len(res.Moved) != 1 || res.Moved[0].A != "moved" || !reflect.DeepEqual(res.Moved[0].B, []string{"sub/moved"}) {
+		t.Errorf("moved %+v, want moved -> [sub/moved]", res.Moved)
+	}
+	if res.Same != 1 {
+		t.Errorf("%d identical, want 1", res.Same)
+	}
+}
@@ -0,0 +1,412 @@
+/*
+Copyright © 2026 Riku Lindblad <riku.lindblad@iki.fi>
+*/
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/lepinkainen/godupe/file"
+	"github.com/lepinkainen/godupe/godupe"
+	"github.com/lepinkainen/godupe/progress"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// dupdirsCmd represents the dupdirs command
+var dupdirsCmd = &cobra.Command{
+	Use:   "dupdirs [directory]",
+	Args:  cobra.MaximumNArgs(1),
+	Short: "Find duplicated directories",
+	Long: `Find duplicated directory trees using the hashes stored in the DB.
+
+Directories with identical file names and contents are reported as identical.
+Directories whose contents are completely found in another directory are
+reported as subsets of it. Directories holding most, but not all, of another
+directory's contents are reported as near supersets of it, with the
+percentage of its files they hold.
+
+Files without a full hash are compared by their partial hash, results
+depending on them are marked as unconfirmed.
+
+Only the given directory is searched, the default is the whole DB.`,
+	Run: dupdirs,
+}
+
+func init() {
+	rootCmd.AddCommand(dupdirsCmd)
+
+	dbPath := defaultDBPath()
+
+	dupdirsCmd.Flags().String("db", dbPath, "DB file to use")
+	dupdirsCmd.Flags().Float64("min-similarity", 90, "Minimum percentage of files contained in another directory to report")
+	dupdirsCmd.Flags().Int("min-files", 2, "Minimum amount of files in a directory to report")
+	dupdirsCmd.Flags().Int("max-copies", 100, "Ignore content stored in more files than this when comparing directories")
+	dupdirsCmd.Flags().String("format", "text", "Output format: text or json")
+}
+
+// dirNode is a directory built from the file paths in the DB
+type dirNode struct {
+	path     string
+	parent   *dirNode
+	files    map[string]string // name -> hash
+	children map[string]*dirNode
+
+	// merkle hash of names and contents of the whole tree
+	merkle string
+	// unique content ids in the whole tree
+	content map[int]struct{}
+	bytes   int64
+	// some files in the tree only have partial hashes
+	partial bool
+}
+
+// dirTree holds the directories and interned content hashes
+type dirTree struct {
+	dirs map[string]*dirNode
+	ids  map[string]int
+	// files with each content id
+	copies map[int]int
+}
+
+func newDirTree() *dirTree {
+	return &dirTree{dirs: map[string]*dirNode{}, ids: map[string]int{}, copies: map[int]int{}}
+}
+
+// buildDirTree builds the directory tree of the stored files. Files without
+// a full hash are added with their partial hash.
+func buildDirTree(entries []godupe.Entry) *dirTree {
+	t := newDirTree()
+	for _, e := range entries {
+		switch {
+		case e.Hash != "":
+			t.add(e.Path, e.Hash, e.Size, false)
+		case e.PartialHash != "":
+			t.add(e.Path, e.PartialHash, e.Size, true)
+		}
+	}
+
+	for _, d := range t.dirs {
+		if d.parent == nil {
+			d.computeMerkle()
+		}
+	}
+	return t
+}
+
+// dir returns the node for the given path, creating it and its parents as needed
+func (t *dirTree) dir(path string) *dirNode {
+	if d, ok := t.dirs[path]; ok {
+		return d
+	}
+
+	d := &dirNode{path: path, files: map[string]string{}, children: map[string]*dirNode{}}
+	t.dirs[path] = d
+
+	parent := filepath.Dir(path)
+	if parent != path {
+		d.parent = t.dir(parent)
+		d.parent.children[filepath.Base(path)] = d
+	}
+
+	return d
+}
+
+// add adds a file to the tree, size and content are added to all parent directories
+func (t *dirTree) add(path, hash string, size int64, partial bool) {
+	d := t.dir(filepath.Dir(path))
+	d.files[filepath.Base(path)] = hash
+
+	id, ok := t.ids[hash]
+	if !ok {
+		id = len(t.ids)
+		t.ids[hash] = id
+	}
+	t.copies[id]++
+
+	for ; d != nil; d = d.parent {
+		if d.content == nil {
+			d.content = map[int]struct{}{}
+		}
+		d.content[id] = struct{}{}
+		d.bytes += size
+		d.partial = d.partial || partial
+	}
+}
+
+// computeMerkle hashes the sorted names and hashes of files and subdirectories
+func (d *dirNode) computeMerkle() string {
+	var names []string
+	for name := range d.files {
+		names = append(names, name)
+	}
+	for name := range d.children {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	h := sha256.New()
+	for _, name := range names {
+		if hash, ok := d.files[name]; ok {
+			fmt.Fprintf(h, "f %s %s\n", name, hash)
+		} else {
+			fmt.Fprintf(h, "d %s %s\n", name, d.children[name].computeMerkle())
+		}
+	}
+
+	d.merkle = fmt.Sprintf("%x", h.Sum(nil))
+	return d.merkle
+}
+
+// identicalDirs is a group of directory trees with identical names and contents
+type identicalDirs struct {
+	Files int      `json:"files"`
+	Bytes int64    `json:"bytes"`
+	Dirs  []string `json:"dirs"`
+	// Some files were only compared by their partial hashes
+	Unconfirmed bool `json:"unconfirmed"`
+}
+
+// containedDir is a directory whose contents are mostly found in another
+// directory. In is a superset of Dir, or a near superset if Subset is false.
+type containedDir struct {
+	Dir         string  `json:"dir"`
+	In          string  `json:"in"`
+	Files       int     `json:"files"`
+	Shared      int     `json:"shared"`
+	Subset      bool    `json:"subset"`
+	Percent     float64 `json:"percent"`
+	Jaccard     float64 `json:"similarity"`
+	Unconfirmed bool    `json:"unconfirmed"`
+}
+
+type dupdirsResult struct {
+	Identical []identicalDirs `json:"identical"`
+	Contained []containedDir  `json:"contained"`
+}
+
+// findIdentical groups directories by merkle hash. Subdirectories of
+// identical directories are not reported separately.
+func findIdentical(t *dirTree, minFiles int) []identicalDirs {
+	groups := map[string][]*dirNode{}
+	for _, d := range t.dirs {
+		if len(d.content) < minFiles {
+			continue
+		}
+		groups[d.merkle] = append(groups[d.merkle], d)
+	}
+
+	res := []identicalDirs{}
+	for _, group := range groups {
+		if len(group) < 2 {
+			continue
+		}
+		// Already covered if all the parents are identical too
+		covered := true
+		for _, d := range group {
+			if d.parent == nil || len(groups[d.parent.merkle]) < 2 {
+				covered = false
+				break
+			}
+		}
+		if covered {
+			continue
+		}
+
+		ident := identicalDirs{Files: len(group[0].content), Bytes: group[0].bytes}
+		for _, d := range group {
+			ident.Dirs = append(ident.Dirs, d.path)
+			ident.Unconfirmed = ident.Unconfirmed || d.partial
+		}
+		sort.Strings(ident.Dirs)
+		res = append(res, ident)
+	}
+
+	sort.Slice(res, func(i, j int) bool { return res[i].Bytes > res[j].Bytes })
+
+	return res
+}
+
+// findContained finds for each directory the smallest other directory that contains
+// most of its content. Directories whose parent is already reported
+// as contained in the same place are skipped. Content stored in more than
+// maxCopies files is ignored.
+func findContained(t *dirTree, minFiles, maxCopies int, minPercent float64) []containedDir {
+	// content id -> directories containing it
+	index := map[int][]*dirNode{}
+	merkles := map[string]int{}
+	for _, d := range t.dirs {
+		for id := range d.content {
+			index[id] = append(index[id], d)
+		}
+		merkles[d.merkle]++
+	}
+
+	best := map[*dirNode]containedDir{}
+	bestSize := map[*dirNode]int{}
+
+	for _, a := range t.dirs {
+		if len(a.content) < minFiles {
+			continue
+		}
+		// Already reported as identical
+		if merkles[a.merkle] > 1 {
+			continue
+		}
+		// Directories with a single subdirectory are reported through the subdirectory
+		if len(a.files) == 0 && len(a.children) == 1 {
+			continue
+		}
+
+		shared := map[*dirNode]int{}
+		for id := range a.content {
+			if t.copies[id] > maxCopies {
+				continue
+			}
+			for _, b := range index[id] {
+				shared[b]++
+			}
+		}
+
+		for b, n := range shared {
+			if b == a || b.merkle == a.merkle || file.IsAncestor(a.path, b.path) || file.IsAncestor(b.path, a.path) {
+				continue
+			}
+
+			percent := 100 * float64(n) / float64(len(a.content))
+			if percent < minPercent {
+				continue
+			}
+
+			// Prefer the highest percentage, then the tightest container,
+			// then the deepest of directories holding the same files
+			if cur, ok := best[a]; ok && !tighter(percent, len(b.content), b.path, cur.Percent, bestSize[a], cur.In) {
+				continue
+			}
+
+			best[a] = containedDir{
+				Dir:         a.path,
+				In:          b.path,
+				Files:       len(a.content),
+				Shared:      n,
+				Subset:      n == len(a.content),
+				Percent:     percent,
+				Jaccard:     100 * float64(n) / float64(len(a.content)+len(b.content)-n),
+				Unconfirmed: a.partial || b.partial,
+			}
+			bestSize[a] = len(b.content)
+		}
+	}
+
+	res := []containedDir{}
+	for a, c := range best {
+		if a.parent != nil {
+			// Implied by the parent being contained in the same tree
+			if p, ok := best[a.parent]; ok && (c.In == p.In || file.IsAncestor(p.In, c.In)) {
+				continue
+			}
+		}
+		// Directories mostly containing each other are only reported once
+		if other, ok := best[t.dirs[c.In]]; ok && other.In == c.Dir && c.Dir > c.In {
+			continue
+		}
+		res = append(res, c)
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Shared != res[j].Shared {
+			return res[i].Shared > res[j].Shared
+		}
+		return res[i].Dir < res[j].Dir
+	})
+
+	return res
+}
+
+// unconfirmed returns the note added to results compared by partial hashes
+func unconfirmed(partial bool) string {
+	if partial {
+		return ", unconfirmed: partial hashes"
+	}
+	return ""
+}
+
+// tighter returns true if container a is a better match than b
+func tighter(percentA float64, sizeA int, pathA string, percentB float64, sizeB int, pathB string) bool {
+	switch {
+	case percentA != percentB:
+		return percentA > percentB
+	case sizeA != sizeB:
+		return sizeA < sizeB
+	case len(pathA) != len(pathB):
+		return len(pathA) > len(pathB)
+	}
+	return pathA < pathB
+}
+
+func printDupdirs(res dupdirsResult, format string) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(res)
+	case "text":
+		for _, ident := range res.Identical {
+			fmt.Printf("Identical (%d files, %s%s):\n", ident.Files, progress.FormatBytes(ident.Bytes), unconfirmed(ident.Unconfirmed))
+			for _, dir := range ident.Dirs {
+				fmt.Printf("  %s\n", dir)
+			}
+		}
+		for _, c := range res.Contained {
+			if c.Subset {
+				fmt.Printf("Subset: %s is contained in %s (%d files, similarity %.1f%%%s)\n", c.Dir, c.In, c.Files, c.Jaccard, unconfirmed(c.Unconfirmed))
+			} else {
+				fmt.Printf("Near superset: %s holds %.1f%% of %s (%d/%d files, similarity %.1f%%%s)\n", c.In, c.Percent, c.Dir, c.Shared, c.Files, c.Jaccard, unconfirmed(c.Unconfirmed))
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown format: %s", format)
+	}
+}
+
+func dupdirs(cmd *cobra.Command, args []string) {
+	viper.AutomaticEnv()
+
+	viper.BindPFlag("db", cmd.Flags().Lookup("db"))
+	viper.BindPFlag("min-similarity", cmd.Flags().Lookup("min-similarity"))
+	viper.BindPFlag("min-files", cmd.Flags().Lookup("min-files"))
+	viper.BindPFlag("max-copies", cmd.Flags().Lookup("max-copies"))
+	viper.BindPFlag("format", cmd.Flags().Lookup("format"))
+
+	log.Infof("Using database %s\n", viper.GetString("db"))
+
+	openStore()
+	defer store.Close()
+
+	root := rootArg(args)
+
+	entries, err := store.Tree(root)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	t := buildDirTree(entries)
+
+	minFiles := viper.GetInt("min-files")
+	res := dupdirsResult{
+		Identical: findIdentical(t, minFiles),
+		Contained: findContained(t, minFiles, viper.GetInt("max-copies"), viper.GetFloat64("min-similarity")),
+	}
+
+	err = printDupdirs(res, viper.GetString("format"))
+	if err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/lepinkainen/godupe/godupe"
+)
+
+// testTree builds a directory tree of files whose contents are given as hashes,
+// hashes starting with p are partial hashes
+func testTree(files map[string]string) *dirTree {
+	var entries []godupe.Entry
+	for path, hash := range files {
+		e := godupe.Entry{Path: path, Size: 1}
+		if strings.HasPrefix(hash, "p") {
+			e.PartialHash = hash
+		} else {
+			e.Hash = hash
+		}
+		entries = append(entries, e)
+	}
+	return buildDirTree(entries)
+}
+
+func TestFindIdentical(t *testing.T) {
+	tree := testTree(map[string]string{
+		"/photos/2019/a":      "1",
+		"/photos/2019/sub/b":  "2",
+		"/backup/2019/a":      "1",
+		"/backup/2019/sub/b":  "2",
+		"/renamed/2019/x":     "1",
+		"/renamed/2019/sub/b": "2",
+		"/partial/one/a":      "p3",
+		"/partial/one/b":      "4",
+		"/partial/two/a":      "p3",
+		"/partial/two/b":      "4",
+		"/backup/other":       "5",
+	})
+
+	res := findIdentical(tree, 2)
+	if len(res) != 2 {
+		t.Fatalf("got %d identical groups, want 2: %+v", len(res), res)
+	}
+	for _, ident := range res {
+		switch ident.Dirs[0] {
+		case "/backup/2019":
+			// sub is covered by its parents, renamed files aren't identical
+			if !reflect.DeepEqual(ident.Dirs, []string{"/backup/2019", "/photos/2019"}) || ident.Unconfirmed {
+				t.Errorf("got %+v, want the 2019 directories confirmed", ident)
+			}
+		case "/partial/one":
+			if !ident.Unconfirmed {
+				t.Errorf("%+v compared by partial hashes isn't unconfirmed", ident)
+			}
+		default:
+			t.Errorf("unexpected group %+v", ident)
+		}
+	}
+}
+
+func TestFindContained(t *testing.T) {
+	files := map[string]string{
+		// subset
+		"/photos/2019/a":   "1",
+		"/photos/2019/b":   "2",
+		"/backup/all/a":    "1",
+		"/backup/all/b":    "2",
+		"/backup/all/c":    "3",
+		"/backup/all/more": "4",
+		// near superset, holds 3 of 4
+		"/docs/a":     "5",
+		"/docs/b":     "6",
+		"/docs/c":     "7",
+		"/docs/d":     "8",
+		"/old/docs/a": "5",
+		"/old/docs/b": "6",
+		"/old/docs/c": "7",
+		"/old/docs/x": "9",
+	}
+	res := findContained(testTree(files), 2, 100, 70)
+
+	want := []containedDir{
+		{Dir: "/docs", In: "/old/docs", Files: 4, Shared: 3, Percent: 75, Jaccard: 60},
+		{Dir: "/photos/2019", In: "/backup/all", Files: 2, Shared: 2, Subset: true, Percent: 100, Jaccard: 50},
+	}
+	if !reflect.DeepEqual(res, want) {
+		t.Errorf("got %+v, want %+v", res, want)
+	}
+}
+
+func TestFindContainedMaxCopies(t *testing.T) {
+	// A single copy deep down isn't common content
+	deep := "/deep"
+	for i := 0; i < 20; i++ {
+		deep += "/d"
+	}
+	files := map[string]string{
+		"/a/x":      "1",
+		"/a/y":      "2",
+		deep + "/x": "1",
+		deep + "/y": "2",
+		deep + "/z": "3",
+	}
+
+	res := findContained(testTree(files), 2, 2, 90)
+	if len(res) != 1 || res[0].Dir != "/a" || res[0].In != deep {
+		t.Errorf("got %+v, want /a contained in %s", res, deep)
+	}
+
+	// Content in more files than allowed is ignored
+	files["/b/x"] = "1"
+	files["/b/y"] = "2"
+	if res := findContained(testTree(files), 2, 2, 90); len(res) != 0 {
+		t.Errorf("got %+v, want nothing", res)
+	}
+}
@@ -0,0 +1,198 @@
+/*
+Copyright © 2026 Riku Lindblad <riku.lindblad@iki.fi>
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/lepinkainen/godupe/db"
+	"github.com/lepinkainen/godupe/file"
+	"github.com/lepinkainen/godupe/progress"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// dupesCmd represents the dupes command
+var dupesCmd = &cobra.Command{
+	Use:   "dupes [directory]",
+	Args:  cobra.MaximumNArgs(1),
+	Short: "List duplicate files",
+	Long: `List files with identical content, grouped by their full hash.
+
+Hardlinks and symlinks to the same file are marked as such, they don't
+take any extra space. The reclaimable space only counts real copies.
+
+Only the given directory is searched, the default is the whole DB
+including merged volumes.`,
+	Run: dupes,
+}
+
+func init() {
+	rootCmd.AddCommand(dupesCmd)
+
+	dbPath := defaultDBPath()
+
+	dupesCmd.Flags().String("db", dbPath, "DB file to use")
+	dupesCmd.Flags().String("format", "text", "Output format: text or json")
+}
+
+// dupeFile is a single file in a duplicate group
+type dupeFile struct {
+	Path string `json:"path"`
+	// Path of the first file in the group sharing the same inode
+	HardlinkOf string `json:"hardlink_of,omitempty"`
+	// Target of a followed symbolic link
+	SymlinkTo string `json:"symlink_to,omitempty"`
+	// On a volume that isn't mounted
+	Offline bool `json:"offline,omitempty"`
+}
+
+// dupeGroup is a set of files with identical content
+type dupeGroup struct {
+	Hash        string     `json:"hash"`
+	Size        int64      `json:"size"`
+	Copies      int        `json:"copies"`
+	Reclaimable int64      `json:"reclaimable"`
+	Files       []dupeFile `json:"files"`
+}
+
+type dupesResult struct {
+	Groups      []dupeGroup `json:"groups"`
+	Files       int         `json:"files"`
+	Hardlinks   int         `json:"hardlinks"`
+	Reclaimable int64       `json:"reclaimable"`
+}
+
+// inodeKey identifies a file on disk
+type inodeKey struct {
+	// Inode numbers of different machines can be the same
+	volume string
+	device uint64
+	inode  uint64
+}
+
+// entryInode returns the stored inode of an entry, or reads it from the file
+// for entries scanned before inodes were stored
+func entryInode(e db.Entry) (inodeKey, bool) {
+	volume, _, onVolume := file.SplitVolumePath(e.Path)
+	if e.Inode != 0 {
+		return inodeKey{volume, e.Device, e.Inode}, true
+	}
+	if _, _, ok := file.SplitArchivePath(e.Path); ok || onVolume {
+		return inodeKey{}, false
+	}
+	info, err := os.Stat(e.Path)
+	if err != nil {
+		return inodeKey{}, false
+	}
+	device, inode, ok := file.Inode(info)
+	return inodeKey{"", device, inode}, ok
+}
+
+// groupDupes builds the duplicate groups from entries ordered by hash
+func groupDupes(entries []db.Entry) dupesResult {
+	res := dupesResult{Groups: []dupeGroup{}}
+
+	for i := 0; i < len(entries); {
+		j := i
+		for j < len(entries) && entries[j].Hash == entries[i].Hash {
+			j++
+		}
+
+		group := dupeGroup{Hash: entries[i].Hash, Size: entries[i].Size}
+		seen := map[inodeKey]string{}
+		for _, e := range entries[i:j] {
+			f := dupeFile{Path: e.Path, SymlinkTo: e.Target}
+			_, online := volumes.LocalPath(e.Path)
+			f.Offline = !online
+			if f.SymlinkTo != "" {
+				// Links don't take any space
+				group.Files = append(group.Files, f)
+				continue
+			}
+			if key, ok := entryInode(e); ok {
+				if first, found := seen[key]; found {
+					f.HardlinkOf = first
+					res.Hardlinks++
+				} else {
+					seen[key] = e.Path
+				}
+			}
+			if f.HardlinkOf == "" {
+				group.Copies++
+			}
+			group.Files = append(group.Files, f)
+		}
+		group.Reclaimable = group.Size * int64(group.Copies-1)
+
+		res.Files += len(group.Files)
+		res.Reclaimable += group.Reclaimable
+		res.Groups = append(res.Groups, group)
+
+		i = j
+	}
+
+	sort.SliceStable(res.Groups, func(i, j int) bool { return res.Groups[i].Reclaimable > res.Groups[j].Reclaimable })
+
+	return res
+}
+
+func printDupes(res dupesResult, format string) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(res)
+	case "text":
+		for _, group := range res.Groups {
+			fmt.Printf("%s (%s, %d files, %d copies, %s reclaimable):\n", group.Hash[:16], progress.FormatBytes(group.Size),
+				len(group.Files), group.Copies, progress.FormatBytes(group.Reclaimable))
+			for _, f := range group.Files {
+				offline := ""
+				if f.Offline {
+					offline = " (offline)"
+				}
+				if f.SymlinkTo != "" {
+					fmt.Printf("  %s (symlink to %s)%s\n", f.Path, f.SymlinkTo, offline)
+				} else if f.HardlinkOf != "" {
+					fmt.Printf("  %s (hardlink of %s)%s\n", f.Path, f.HardlinkOf, offline)
+				} else {
+					fmt.Printf("  %s%s\n", f.Path, offline)
+				}
+			}
+		}
+		fmt.Printf("%d groups, %d files, %d hardlinks, %s reclaimable\n", len(res.Groups), res.Files, res.Hardlinks, progress.FormatBytes(res.Reclaimable))
+		return nil
+	default:
+		return fmt.Errorf("unknown format: %s", format)
+	}
+}
+
+func dupes(cmd *cobra.Command, args []string) {
+	viper.AutomaticEnv()
+
+	viper.BindPFlag("db", cmd.Flags().Lookup("db"))
+	viper.BindPFlag("format", cmd.Flags().Lookup("format"))
+
+	log.Infof("Using database %s\n", viper.GetString("db"))
+
+	openStore()
+	defer store.Close()
+
+	root := rootArg(args)
+
+	dupes, err := store.Duplicates(root)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = printDupes(groupDupes(dupes), viper.GetString("format"))
+	if err != nil {
+		log.Fatal(err)
+	}
+}
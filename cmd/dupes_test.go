@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/lepinkainen/godupe/godupe"
+	"github.com/lepinkainen/godupe/metrics"
+)
+
+func TestGroupDupes(t *testing.T) {
+	dir := scanTemp(t, map[string]string{
+		"a":      "same",
+		"sub/b":  "same",
+		"big1":   "larger copies",
+		"big2":   "larger copies",
+		"unique": "only one",
+	})
+	a, link := filepath.Join(dir, "a"), filepath.Join(dir, "link")
+	if err := os.Link(a, link); err != nil {
+		t.Fatal(err)
+	}
+
+	scanner, err := godupe.NewScanner(godupe.ScannerOptions{Store: store, Volumes: volumes})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hashed := metrics.Value(metrics.FilesHashed)
+	if err := scanner.Scan(dir); err != nil {
+		t.Fatal(err)
+	}
+	// The hardlink has the hash of a
+	if n := metrics.Value(metrics.FilesHashed) - hashed; n != 0 {
+		t.Errorf("hashed %v files, want 0", n)
+	}
+
+	entries, err := store.Duplicates(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := groupDupes(entries)
+
+	if res.Files != 5 || res.Hardlinks != 1 || res.Reclaimable != 13+4 {
+		t.Errorf("%d files, %d hardlinks, %d bytes reclaimable, want 5, 1 and 17", res.Files, res.Hardlinks, res.Reclaimable)
+	}
+	if len(res.Groups) != 2 {
+		t.Fatalf("%d groups, want 2", len(res.Groups))
+	}
+	// Most reclaimable first
+	if res.Groups[0].Size != 13 || res.Groups[0].Copies != 2 {
+		t.Errorf("first group %+v, want the larger copies", res.Groups[0])
+	}
+
+	small := res.Groups[1]
+	if small.Copies != 2 || small.Reclaimable != 4 {
+		t.Errorf("%d copies, %d bytes reclaimable, want 2 and 4", small.Copies, small.Reclaimable)
+	}
+	want := []dupeFile{{Path: a}, {Path: link, HardlinkOf: a}, {Path: filepath.Join(dir, "sub/b")}}
+	if !reflect.DeepEqual(small.Files, want) {
+		t.Errorf("files %+v, want %+v", small.Files, want)
+	}
+}
@@ -0,0 +1,218 @@
+/*
+Copyright © 2026 Riku Lindblad <riku.lindblad@iki.fi>
+*/
+package cmd
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/lepinkainen/godupe/file"
+	"github.com/lepinkainen/godupe/godupe"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"lukechampine.com/blake3"
+)
+
+// exportCmd represents the export command
+var exportCmd = &cobra.Command{
+	Use:   "export [path]",
+	Args:  cobra.MaximumNArgs(1),
+	Short: "Export stored hashes as a manifest",
+	Long: `Write the stored hashes of the files under the given path to stdout.
+
+Formats:
+  sha256sum  lines of "hash  path", readable by 'sha256sum -c'
+  b3sum      lines of "hash  path" with BLAKE3 hashes, readable by 'b3sum -c'
+  csv        all stored columns with a header row
+  json       all stored columns as an array of objects
+
+Only files with a full hash are written as sha256sum and b3sum lines.
+
+The DB only stores SHA-256 hashes, so b3sum reads the files again. Files
+whose content no longer matches the stored hash, archive members and
+files on volumes that aren't mounted are left out.
+
+The default path is the whole DB.`,
+	Run: export,
+}
+
+func init() {
+	rootCmd.AddCommand(exportCmd)
+
+	dbPath := defaultDBPath()
+
+	exportCmd.Flags().String("db", dbPath, "DB file to use")
+	exportCmd.Flags().String("format", "sha256sum", "Manifest format: sha256sum, b3sum, csv or json")
+	exportCmd.Flags().Bool("relative", false, "Write paths relative to the exported path")
+}
+
+// exportEntry is a single file in csv and json manifests
+type exportEntry struct {
+	Path        string `json:"path"`
+	Hash        string `json:"hash,omitempty"`
+	PartialHash string `json:"partialhash,omitempty"`
+	Size        int64  `json:"size,omitempty"`
+	Mtime       int64  `json:"mtime,omitempty"`
+	SymlinkTo   string `json:"symlink_to,omitempty"`
+	// Manifest the hash was imported from
+	Source string `json:"source,omitempty"`
+	// Only computed for b3sum manifests
+	BLAKE3 string `json:"-"`
+}
+
+// escapeManifestPath escapes a path the way sha256sum does, backslashes and
+// newlines are escaped and the line is prefixed with a backslash
+func escapeManifestPath(path string) (string, bool) {
+	if !strings.ContainsAny(path, "\\\n\r") {
+		return path, false
+	}
+	r := strings.NewReplacer("\\", "\\\\", "\n", "\\n", "\r", "\\r")
+	return r.Replace(path), true
+}
+
+// writeSums writes the lines of sha256sum style manifests, entries without a hash are skipped
+func writeSums(w io.Writer, entries []exportEntry, hash func(exportEntry) string) error {
+	bw := bufio.NewWriter(w)
+	for _, e := range entries {
+		if hash(e) == "" {
+			continue
+		}
+		path, escaped := escapeManifestPath(e.Path)
+		if escaped {
+			bw.WriteString("\\")
+		}
+		fmt.Fprintf(bw, "%s  %s\n", hash(e), path)
+	}
+	return bw.Flush()
+}
+
+// blake3Sum reads a file and returns its BLAKE3 hash,
+// if its SHA-256 still matches the stored hash
+func blake3Sum(path, stored string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	b3 := blake3.New(32, nil)
+	sha := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(b3, sha), f); err != nil {
+		return "", err
+	}
+	if fmt.Sprintf("%x", sha.Sum(nil)) != stored {
+		return "", errors.New("changed since it was hashed")
+	}
+	return fmt.Sprintf("%x", b3.Sum(nil)), nil
+}
+
+// storedBLAKE3 returns the BLAKE3 hash of a stored file, empty if it can't be exported
+func storedBLAKE3(e godupe.Entry) string {
+	if e.Hash == "" || e.Target != "" {
+		return ""
+	}
+	if _, _, ok := file.SplitArchivePath(e.Path); ok {
+		log.Debugf("Can't read archive member %s for b3sum\n", e.Path)
+		return ""
+	}
+	path, ok := volumes.LocalPath(e.Path)
+	if !ok {
+		log.Warnf("Skipping %s, the volume isn't mounted", e.Path)
+		return ""
+	}
+
+	hash, err := blake3Sum(path, e.Hash)
+	if err != nil {
+		log.Warnf("Skipping %s: %s", e.Path, err)
+		return ""
+	}
+	return hash
+}
+
+func writeManifest(w io.Writer, entries []exportEntry, format string) error {
+	switch format {
+	case "sha256sum":
+		return writeSums(w, entries, func(e exportEntry) string { return e.Hash })
+	case "b3sum":
+		return writeSums(w, entries, func(e exportEntry) string { return e.BLAKE3 })
+	case "csv":
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"path", "hash", "partialhash", "size", "mtime", "symlink_to", "source"})
+		for _, e := range entries {
+			cw.Write([]string{e.Path, e.Hash, e.PartialHash, strconv.FormatInt(e.Size, 10),
+				strconv.FormatInt(e.Mtime, 10), e.SymlinkTo, e.Source})
+		}
+		cw.Flush()
+		return cw.Error()
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(entries)
+	default:
+		return fmt.Errorf("unknown format: %s", format)
+	}
+}
+
+func export(cmd *cobra.Command, args []string) {
+	viper.AutomaticEnv()
+
+	viper.BindPFlag("db", cmd.Flags().Lookup("db"))
+	viper.BindPFlag("format", cmd.Flags().Lookup("format"))
+	viper.BindPFlag("relative", cmd.Flags().Lookup("relative"))
+
+	log.Infof("Using database %s\n", viper.GetString("db"))
+
+	openStore()
+	defer store.Close()
+
+	root := rootArg(args)
+
+	stored, err := storedTree(root)
+	if err != nil {
+		log.Fatal(err)
+	}
+	sort.Slice(stored, func(i, j int) bool { return stored[i].Path < stored[j].Path })
+
+	format := viper.GetString("format")
+	entries := []exportEntry{}
+	for _, e := range stored {
+		path := e.Path
+		if viper.GetBool("relative") && root != "" {
+			if rel, err := filepath.Rel(root, path); err == nil && rel != "." {
+				path = rel
+			} else {
+				// A single exported file
+				path = filepath.Base(path)
+			}
+		}
+		entries = append(entries, exportEntry{
+			Path:        path,
+			Hash:        e.Hash,
+			PartialHash: e.PartialHash,
+			Size:        e.Size,
+			Mtime:       e.Mtime,
+			SymlinkTo:   e.Target,
+			Source:      e.Source,
+		})
+		if format == "b3sum" {
+			entries[len(entries)-1].BLAKE3 = storedBLAKE3(e)
+		}
+	}
+
+	err = writeManifest(os.Stdout, entries, format)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
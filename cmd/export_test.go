@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExportB3sum(t *testing.T) {
+	dir := scanTemp(t, map[string]string{"abc": "abc", "changed": "original"})
+	if err := os.WriteFile(filepath.Join(dir, "changed"), []byte("edited"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := store.Tree(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entries []exportEntry
+	for _, e := range stored {
+		rel, _ := filepath.Rel(dir, e.Path)
+		entries = append(entries, exportEntry{Path: rel, Hash: e.Hash, BLAKE3: storedBLAKE3(e)})
+	}
+
+	var buf bytes.Buffer
+	if err := writeManifest(&buf, entries, "b3sum"); err != nil {
+		t.Fatal(err)
+	}
+	// Changed files don't match the stored hash any more
+	want := "6437b3ac38465133ffb63b75273a8db548c558465d79db03fd359c6cd5bd9d85  abc\n"
+	if buf.String() != want {
+		t.Errorf("got manifest %q, want %q", buf.String(), want)
+	}
+}
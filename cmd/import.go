@@ -0,0 +1,232 @@
+/*
+Copyright © 2026 Riku Lindblad <riku.lindblad@iki.fi>
+*/
+package cmd
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/lepinkainen/godupe/file"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// importCmd represents the import command
+var importCmd = &cobra.Command{
+	Use:   "import [source] [destination]",
+	Args:  cobra.ExactArgs(2),
+	Short: "Copy files not already in the DB to the destination",
+	Long: `Copy files from source to destination, skipping files whose content
+is already in the DB. Copies are verified and added to the DB.
+
+The destination path of each file is built from the --layout template.
+Available fields are .Dir (directory relative to source), .Name, .Ext
+and .Year, .Month, .Day from the file's modification time, e.g.
+
+  godupe import /media/sdcard ~/Photos --layout '{{.Year}}/{{.Month}}/{{.Name}}'`,
+	Run: importFiles,
+}
+
+func init() {
+	rootCmd.AddCommand(importCmd)
+
+	dbPath := defaultDBPath()
+
+	importCmd.Flags().String("db", dbPath, "DB file to use")
+	importCmd.Flags().String("layout", "{{.Dir}}/{{.Name}}", "Template for destination paths")
+	importCmd.Flags().BoolP("dry-run", "n", false, "Only print what would be copied")
+}
+
+// layoutFields are the values available in the destination layout template
+type layoutFields struct {
+	Dir   string
+	Name  string
+	Ext   string
+	Year  string
+	Month string
+	Day   string
+}
+
+// importer copies new files from one tree to another
+type importer struct {
+	src    string
+	dest   string
+	layout *template.Template
+	dryRun bool
+
+	// destinations of the files a dry run would have copied, by hash
+	planned map[string]string
+
+	imported int
+	skipped  int
+	failed   int
+}
+
+// destination returns the path a file will be copied to
+func (im *importer) destination(path string, info fs.FileInfo) (string, error) {
+	rel, err := filepath.Rel(im.src, path)
+	if err != nil {
+		return "", err
+	}
+
+	mtime := info.ModTime()
+	fields := layoutFields{
+		Dir:   filepath.Dir(rel),
+		Name:  filepath.Base(rel),
+		Ext:   strings.TrimPrefix(filepath.Ext(rel), "."),
+		Year:  mtime.Format("2006"),
+		Month: mtime.Format("01"),
+		Day:   mtime.Format("02"),
+	}
+
+	var sb strings.Builder
+	err = im.layout.Execute(&sb, fields)
+	if err != nil {
+		return "", err
+	}
+
+	dest := filepath.Join(im.dest, filepath.Clean(sb.String()))
+	// Don't let a layout write outside the destination
+	if !file.IsAncestor(im.dest, dest) {
+		return "", fmt.Errorf("layout produced a path outside %s: %s", im.dest, dest)
+	}
+
+	return dest, nil
+}
+
+// importFile copies a single file if its content isn't in the DB yet
+func (im *importer) importFile(path string) error {
+	_, size, hash, err := file.Hash(path, 0, nil)
+	if err != nil {
+		return err
+	}
+
+	if size == 0 {
+		log.Debugf("skipping empty file: %s\n", path)
+		return nil
+	}
+
+	copies, err := store.FindByHash(hash, size, false)
+	if err != nil {
+		return err
+	}
+	if len(copies) > 0 {
+		log.Debugf("skipping: %s, already in %s\n", path, copies[0])
+		im.skipped++
+		return nil
+	}
+	// A real run would have stored the earlier copy
+	if planned, ok := im.planned[hash]; ok {
+		log.Debugf("skipping: %s, already imported to %s\n", path, planned)
+		im.skipped++
+		return nil
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	dest, err := im.destination(path, info)
+	if err != nil {
+		return err
+	}
+	dest = file.FreeName(dest)
+
+	if im.dryRun {
+		fmt.Printf("Would import: %s -> %s\n", path, dest)
+		im.planned[hash] = dest
+		im.imported++
+		return nil
+	}
+
+	err = file.Copy(path, dest)
+	if err != nil {
+		return err
+	}
+
+	// Make sure the copy is identical before recording it
+	_, copySize, copyHash, err := file.Hash(dest, 0, nil)
+	if err != nil {
+		return err
+	}
+	if copySize != size || copyHash != hash {
+		os.Remove(dest)
+		return fmt.Errorf("verification failed for %s", dest)
+	}
+
+	err = store.Save(volumes.DBPath(dest), size, hash, 0)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Imported: %s -> %s\n", path, dest)
+	im.imported++
+
+	return nil
+}
+
+func (im *importer) walkDirFunc(path string, d fs.DirEntry, err error) error {
+	if err != nil {
+		log.Errorf("Error accessing directory: %s\n", path)
+		return err
+	}
+
+	if !d.Type().IsRegular() {
+		return nil
+	}
+
+	err = im.importFile(path)
+	if err != nil {
+		log.Errorf("Error importing %s: %s\n", path, err)
+		im.failed++
+	}
+
+	return nil
+}
+
+func importFiles(cmd *cobra.Command, args []string) {
+	viper.AutomaticEnv()
+
+	viper.BindPFlag("db", cmd.Flags().Lookup("db"))
+	viper.BindPFlag("layout", cmd.Flags().Lookup("layout"))
+	viper.BindPFlag("dry-run", cmd.Flags().Lookup("dry-run"))
+
+	log.Infof("Using database %s\n", viper.GetString("db"))
+
+	layout, err := template.New("layout").Option("missingkey=error").Parse(viper.GetString("layout"))
+	if err != nil {
+		log.Fatalf("Invalid layout: %s", err)
+	}
+
+	src, err := filepath.Abs(args[0])
+	if err != nil {
+		log.Fatal(err)
+	}
+	dest, err := filepath.Abs(args[1])
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	im := &importer{
+		src:     src,
+		dest:    dest,
+		layout:  layout,
+		dryRun:  viper.GetBool("dry-run"),
+		planned: map[string]string{},
+	}
+
+	openStore()
+	defer store.Close()
+	if err := volumes.Register(dest, false); err != nil {
+		log.Fatal(err)
+	}
+	filepath.WalkDir(src, im.walkDirFunc)
+
+	log.Infof("Imported %d files, skipped %d already in DB, %d failed", im.imported, im.skipped, im.failed)
+}
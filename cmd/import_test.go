@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"text/template"
+	"time"
+)
+
+// testLayout parses a destination layout template
+func testLayout(t *testing.T, layout string) *template.Template {
+	tmpl, err := template.New("layout").Option("missingkey=error").Parse(layout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tmpl
+}
+
+// fileInfo is the stat of a file with a fixed modification time
+type fileInfo struct {
+	os.FileInfo
+	mtime time.Time
+}
+
+func (i fileInfo) ModTime() time.Time { return i.mtime }
+
+func TestImportDestination(t *testing.T) {
+	info := fileInfo{mtime: time.Date(2019, 7, 3, 0, 0, 0, 0, time.UTC)}
+
+	tests := []struct {
+		dest, layout, want string
+		wantErr            bool
+	}{
+		{"/photos", "{{.Dir}}/{{.Name}}", "/photos/sub/img.jpg", false},
+		{"/photos", "{{.Year}}/{{.Month}}/{{.Day}}.{{.Ext}}", "/photos/2019/07/03.jpg", false},
+		// Everything is under the root
+		{"/", "{{.Dir}}/{{.Name}}", "/sub/img.jpg", false},
+		{"/photos", "../{{.Name}}", "", true},
+		{"/photos", "{{.Missing}}", "", true},
+	}
+	for _, tt := range tests {
+		im := &importer{src: "/card", dest: tt.dest, layout: testLayout(t, tt.layout)}
+		got, err := im.destination("/card/sub/img.jpg", info)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("destination in %s with %s = %q, %v, want %q", tt.dest, tt.layout, got, err, tt.want)
+		}
+	}
+}
+
+func TestImportFiles(t *testing.T) {
+	dir := scanTemp(t, map[string]string{"archive/have": "already archived"})
+	src, dest := filepath.Join(dir, "card"), filepath.Join(dir, "archive")
+	for name, data := range map[string]string{"new": "new", "sub/new": "new", "old": "already archived"} {
+		path := filepath.Join(src, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, dryRun := range []bool{true, false} {
+		im := &importer{src: src, dest: dest, layout: testLayout(t, "{{.Name}}"), dryRun: dryRun, planned: map[string]string{}}
+		if err := filepath.WalkDir(src, im.walkDirFunc); err != nil {
+			t.Fatal(err)
+		}
+		// Copies within the source are only imported once
+		if im.imported != 1 || im.skipped != 2 || im.failed != 0 {
+			t.Errorf("dry run %v: imported %d, skipped %d, failed %d, want 1, 2, 0", dryRun, im.imported, im.skipped, im.failed)
+		}
+	}
+
+	data, err := os.ReadFile(filepath.Join(dest, "new"))
+	if err != nil || string(data) != "new" {
+		t.Errorf("imported file has %q, %v", data, err)
+	}
+	if copies, err := store.FindByHash(fmt.Sprintf("%x", sha256.Sum256([]byte("new"))), 3, false); err != nil || len(copies) != 1 {
+		t.Errorf("imported file stored as %v, %v", copies, err)
+	}
+}
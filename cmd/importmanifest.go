@@ -0,0 +1,191 @@
+/*
+Copyright © 2026 Riku Lindblad <riku.lindblad@iki.fi>
+*/
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/lepinkainen/godupe/db"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// importManifestCmd represents the import-manifest command
+var importManifestCmd = &cobra.Command{
+	Use:   "import-manifest [manifest]...",
+	Args:  cobra.MinimumNArgs(1),
+	Short: "Load hashes from sha256sum manifests into the DB",
+	Long: `Load SHA-256 hashes from manifest files into the DB without hashing
+the files. The rows are marked with the manifest they were imported from.
+
+Both the GNU format ("hash  path", "hash *path") and the BSD format
+("SHA256 (path) = hash") are supported.
+
+Relative paths are relative to the directory of the manifest unless
+--base is given. Files already in the DB with a full hash are kept
+unless --overwrite is given. The listed files don't need to exist.
+
+Imported hashes aren't checked against the files, verify counts them
+as unverifiable.`,
+	Run: importManifest,
+}
+
+func init() {
+	rootCmd.AddCommand(importManifestCmd)
+
+	dbPath := defaultDBPath()
+
+	importManifestCmd.Flags().String("db", dbPath, "DB file to use")
+	importManifestCmd.Flags().String("base", "", "Directory relative paths are resolved against")
+	importManifestCmd.Flags().Bool("overwrite", false, "Replace full hashes already in the DB")
+}
+
+var (
+	gnuManifestLine = regexp.MustCompile(`^([0-9a-fA-F]{64}) [ *](.+)$`)
+	bsdManifestLine = regexp.MustCompile(`^SHA256 \((.+)\) = ([0-9a-fA-F]{64})$`)
+)
+
+// unescapeManifestPath reverses escapeManifestPath
+func unescapeManifestPath(path string) string {
+	var sb strings.Builder
+	for i := 0; i < len(path); i++ {
+		if path[i] != '\\' || i == len(path)-1 {
+			sb.WriteByte(path[i])
+			continue
+		}
+		i++
+		switch path[i] {
+		case 'n':
+			sb.WriteByte('\n')
+		case 'r':
+			sb.WriteByte('\r')
+		default:
+			sb.WriteByte(path[i])
+		}
+	}
+	return sb.String()
+}
+
+// parseManifestLine returns the hash and path of a single manifest line
+func parseManifestLine(line string) (hash, path string, ok bool) {
+	escaped := strings.HasPrefix(line, "\\")
+	if escaped {
+		line = line[1:]
+	}
+
+	if m := gnuManifestLine.FindStringSubmatch(line); m != nil {
+		hash, path = m[1], m[2]
+	} else if m := bsdManifestLine.FindStringSubmatch(line); m != nil {
+		path, hash = m[1], m[2]
+	} else {
+		return "", "", false
+	}
+
+	if escaped {
+		path = unescapeManifestPath(path)
+	}
+	return strings.ToLower(hash), path, true
+}
+
+// importManifestFile loads a single manifest, returning the amount of imported and kept files
+func importManifestFile(manifest, base string, overwrite bool) (int, int, error) {
+	source, err := filepath.Abs(manifest)
+	if err != nil {
+		return 0, 0, err
+	}
+	if base == "" {
+		base = filepath.Dir(source)
+	}
+
+	f, err := os.Open(source)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	imported, kept := 0, 0
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		hash, path, ok := parseManifestLine(line)
+		if !ok {
+			log.Warnf("%s:%d: not a SHA-256 manifest line", manifest, lineNo)
+			continue
+		}
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(base, path)
+		}
+		path = filepath.Clean(path)
+		// Files on volumes are stored relative to the volume like scanned ones
+		key := volumes.DBPath(path)
+
+		if !overwrite {
+			res, err := store.Exists(key)
+			if err != nil {
+				return imported, kept, err
+			}
+			if res == db.HashTypeFull {
+				log.Debugf("Already hashed: %s\n", path)
+				kept++
+				continue
+			}
+		}
+
+		// Sizes of existing files are needed to find them by content. The
+		// hash isn't checked against the file, so no modification time or
+		// inode is stored for verify or hardlink and move detection to trust.
+		var size int64
+		if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+			size = info.Size()
+		}
+		if err := store.Import(key, hash, size, source); err != nil {
+			return imported, kept, err
+		}
+		imported++
+	}
+
+	return imported, kept, scanner.Err()
+}
+
+func importManifest(cmd *cobra.Command, args []string) {
+	viper.AutomaticEnv()
+
+	viper.BindPFlag("db", cmd.Flags().Lookup("db"))
+	viper.BindPFlag("base", cmd.Flags().Lookup("base"))
+	viper.BindPFlag("overwrite", cmd.Flags().Lookup("overwrite"))
+
+	log.Infof("Using database %s\n", viper.GetString("db"))
+
+	base := viper.GetString("base")
+	if base != "" {
+		var err error
+		base, err = filepath.Abs(base)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	openStore()
+	defer store.Close()
+
+	for _, manifest := range args {
+		imported, kept, err := importManifestFile(manifest, base, viper.GetBool("overwrite"))
+		if err != nil {
+			log.Errorf("Error reading manifest %s: %s\n", manifest, err)
+			continue
+		}
+		fmt.Printf("%s: imported %d files, kept %d already hashed\n", manifest, imported, kept)
+	}
+}
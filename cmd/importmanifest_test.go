@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseManifestLine(t *testing.T) {
+	hash := strings.Repeat("ab", 32)
+
+	tests := []struct {
+		line     string
+		wantPath string
+		wantOK   bool
+	}{
+		{hash + "  photos/img.jpg", "photos/img.jpg", true},
+		{hash + " *bin/file", "bin/file", true},
+		{strings.ToUpper(hash) + "  upper", "upper", true},
+		{hash + "  two  spaces", "two  spaces", true},
+		{"SHA256 (photos/img (1).jpg) = " + hash, "photos/img (1).jpg", true},
+		{"\\" + hash + "  new\\nline\\\\back", "new\nline\\back", true},
+		{hash + "  not\\nescaped", "not\\nescaped", true},
+		{hash[:40] + "  sha1", "", false},
+		{"", "", false},
+		{"# comment", "", false},
+	}
+	for _, tt := range tests {
+		gotHash, gotPath, ok := parseManifestLine(tt.line)
+		if ok != tt.wantOK || gotPath != tt.wantPath {
+			t.Errorf("parseManifestLine(%q) = %q, %v, want %q, %v", tt.line, gotPath, ok, tt.wantPath, tt.wantOK)
+		}
+		if ok && gotHash != hash {
+			t.Errorf("parseManifestLine(%q) hash = %q, want lower case %q", tt.line, gotHash, hash)
+		}
+	}
+}
+
+func TestEscapeManifestPath(t *testing.T) {
+	for _, path := range []string{"plain", "new\nline", "back\\slash", "cr\r", "\\n"} {
+		escaped, ok := escapeManifestPath(path)
+		if ok != strings.ContainsAny(path, "\\\n\r") {
+			t.Errorf("escapeManifestPath(%q) escaped = %v", path, ok)
+		}
+		if strings.ContainsAny(escaped, "\n\r") {
+			t.Errorf("escapeManifestPath(%q) = %q, still has line breaks", path, escaped)
+		}
+
+		// As written by export and read by import-manifest
+		line := strings.Repeat("0", 64) + "  " + escaped
+		if ok {
+			line = "\\" + line
+		}
+		if _, got, _ := parseManifestLine(line); got != path {
+			t.Errorf("%q read back as %q", path, got)
+		}
+	}
+}
+
+func TestImportManifestUnverified(t *testing.T) {
+	dir := scanTemp(t, map[string]string{"scanned": "edited"})
+	if err := os.WriteFile(filepath.Join(dir, "new"), []byte("edited"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Written before the files were edited
+	stale := fmt.Sprintf("%x", sha256.Sum256([]byte("original")))
+	manifest := filepath.Join(dir, "SHA256SUMS")
+	err := os.WriteFile(manifest, []byte(stale+"  scanned\n"+stale+"  new\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	imported, _, err := importManifestFile(manifest, "", true)
+	if err != nil || imported != 2 {
+		t.Fatalf("imported %d files, %v", imported, err)
+	}
+
+	entries, err := store.Tree(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if e.Mtime != 0 || e.Inode != 0 {
+			t.Errorf("%s stored with the stat of the file, the hash wasn't checked", e.Path)
+		}
+	}
+
+	// The hashes don't match the files, but they were never checked
+	res := verifyEntries(entries, 100, nil)
+	if len(res.Corrupt) != 0 || res.Unverifiable != 2 {
+		t.Errorf("%d corrupt, %d unverifiable, want 0 and 2", len(res.Corrupt), res.Unverifiable)
+	}
+}
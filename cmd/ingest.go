@@ -0,0 +1,74 @@
+/*
+Copyright © 2026 Riku Lindblad <riku.lindblad@iki.fi>
+*/
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+
+	"github.com/lepinkainen/godupe/file"
+	"github.com/lepinkainen/godupe/godupe"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// ingestCmd represents the ingest command
+var ingestCmd = &cobra.Command{
+	Use:   "ingest [address]",
+	Args:  cobra.MaximumNArgs(1),
+	Short: "Load the results of an agent on another machine",
+	Long: `Load the hashes streamed by 'godupe agent' into the DB. The results are
+read from stdin, or from an agent listening on the given address.
+
+The paths are stored on the volume given with --volume,
+/srv/img.jpg becomes nas:/srv/img.jpg.`,
+	Run: ingest,
+}
+
+func init() {
+	rootCmd.AddCommand(ingestCmd)
+
+	dbPath := defaultDBPath()
+
+	ingestCmd.Flags().String("db", dbPath, "DB file to use")
+	ingestCmd.Flags().String("volume", "", "Host or volume name to store the agent's paths on")
+	ingestCmd.MarkFlagRequired("volume")
+}
+
+func ingest(cmd *cobra.Command, args []string) {
+	viper.AutomaticEnv()
+
+	viper.BindPFlag("db", cmd.Flags().Lookup("db"))
+	viper.BindPFlag("volume", cmd.Flags().Lookup("volume"))
+
+	volume := viper.GetString("volume")
+	if !file.ValidVolumeName(volume) {
+		log.Fatalf("invalid volume name: %s", volume)
+	}
+
+	log.Infof("Using database %s\n", viper.GetString("db"))
+
+	var r io.Reader = os.Stdin
+	if len(args) == 1 && args[0] != "-" {
+		conn, err := net.Dial("tcp", args[0])
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer conn.Close()
+		r = conn
+	}
+
+	openStore()
+	defer store.Close()
+
+	n, err := godupe.Ingest(store, r, volume)
+	if err != nil {
+		log.Errorf("Error reading results: %s", err)
+	}
+
+	fmt.Printf("Ingested %d files on volume %s\n", n, volume)
+}
@@ -0,0 +1,123 @@
+/*
+Copyright © 2026 Riku Lindblad <riku.lindblad@iki.fi>
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lepinkainen/godupe/metrics"
+	"github.com/lepinkainen/godupe/progress"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// levelCounter is a logrus hook counting the warnings and errors logged during the run,
+// fatal errors are counted as errors
+type levelCounter struct {
+	mu       sync.Mutex
+	warnings int
+	errors   int
+}
+
+func (c *levelCounter) Levels() []log.Level {
+	return []log.Level{log.FatalLevel, log.ErrorLevel, log.WarnLevel}
+}
+
+func (c *levelCounter) Fire(entry *log.Entry) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if entry.Level == log.WarnLevel {
+		c.warnings++
+	} else {
+		c.errors++
+	}
+	return nil
+}
+
+// logCounts counts the messages for the run summary
+var logCounts = &levelCounter{}
+
+// runStart is the time the command started
+var runStart time.Time
+
+// setupLogging configures logrus with the log flags, --verbose turns on debug messages
+func setupLogging(cmd *cobra.Command, args []string) {
+	runStart = time.Now()
+
+	level, err := log.ParseLevel(viper.GetString("log-level"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if viper.GetBool("verbose") && level < log.DebugLevel {
+		level = log.DebugLevel
+	}
+	log.SetLevel(level)
+
+	switch viper.GetString("log-format") {
+	case "text":
+		log.SetFormatter(&log.TextFormatter{})
+	case "json":
+		log.SetFormatter(&log.JSONFormatter{})
+	default:
+		log.Fatalf("unknown log format: %s", viper.GetString("log-format"))
+	}
+
+	if path := viper.GetString("log-file"); path != "" {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.SetOutput(f)
+	}
+
+	log.AddHook(logCounts)
+	// log.Fatal exits without running PersistentPostRun
+	log.RegisterExitHandler(func() { logSummary(cmd, args) })
+}
+
+// plural returns the amount and the noun, with an s if there's more or less than one
+func plural(n int, noun string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, noun)
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+// logSummary logs what the command did, as a warning if there were errors
+func logSummary(cmd *cobra.Command, args []string) {
+	logCounts.mu.Lock()
+	warnings, errors := logCounts.warnings, logCounts.errors
+	logCounts.mu.Unlock()
+
+	var parts []string
+	hashed := int(metrics.Value(metrics.FilesHashed))
+	skipped := int(metrics.Value(metrics.FilesSkipped))
+	if hashed+skipped > 0 {
+		parts = append(parts,
+			fmt.Sprintf("%d files hashed", hashed),
+			fmt.Sprintf("%d skipped", skipped),
+			fmt.Sprintf("%s read", progress.FormatBytes(int64(metrics.Value(metrics.BytesRead)))))
+	}
+	parts = append(parts, plural(errors, "error"), plural(warnings, "warning"))
+
+	elapsed := time.Since(runStart).Round(time.Millisecond)
+	entry := log.WithFields(log.Fields{
+		"command":  cmd.Name(),
+		"duration": elapsed.String(),
+		"errors":   errors,
+		"warnings": warnings,
+	})
+	msg := fmt.Sprintf("Finished in %s: %s", elapsed, strings.Join(parts, ", "))
+	if errors > 0 {
+		entry.Warn(msg)
+	} else {
+		entry.Info(msg)
+	}
+}
@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+func TestLevelCounter(t *testing.T) {
+	counter := &levelCounter{}
+	logger := log.New()
+	logger.SetOutput(io.Discard)
+	logger.AddHook(counter)
+
+	logger.Debug("not counted")
+	logger.Info("not counted")
+	logger.Warn("warning")
+	logger.Error("error")
+	logger.Error("error")
+
+	if counter.warnings != 1 || counter.errors != 2 {
+		t.Errorf("counted %d warnings and %d errors, want 1 and 2", counter.warnings, counter.errors)
+	}
+}
+
+func TestLogSummary(t *testing.T) {
+	var buf bytes.Buffer
+	oldOut, oldFormatter, oldCounts, oldStart := log.StandardLogger().Out, log.StandardLogger().Formatter, logCounts, runStart
+	defer func() {
+		log.SetOutput(oldOut)
+		log.SetFormatter(oldFormatter)
+		logCounts, runStart = oldCounts, oldStart
+	}()
+	log.SetOutput(&buf)
+	log.SetFormatter(&log.JSONFormatter{})
+
+	logCounts = &levelCounter{warnings: 2, errors: 1}
+	runStart = time.Now()
+	logSummary(&cobra.Command{Use: "scan"}, nil)
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("summary %q isn't a JSON log line: %s", buf.String(), err)
+	}
+	// Errors make the summary a warning
+	if entry["level"] != "warning" || entry["command"] != "scan" || entry["errors"] != 1.0 || entry["warnings"] != 2.0 {
+		t.Errorf("summary logged as %v", entry)
+	}
+	if msg, _ := entry["msg"].(string); !strings.HasPrefix(msg, "Finished in ") || !strings.HasSuffix(msg, "1 error, 2 warnings") {
+		t.Errorf("summary message %q", msg)
+	}
+}
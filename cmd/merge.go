@@ -0,0 +1,63 @@
+/*
+Copyright © 2026 Riku Lindblad <riku.lindblad@iki.fi>
+*/
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/lepinkainen/godupe/file"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// mergeCmd represents the db merge command
+var mergeCmd = &cobra.Command{
+	Use:   "merge [other db]",
+	Args:  cobra.ExactArgs(1),
+	Short: "Merge the rows of another DB",
+	Long: `Copy the rows of another DB, e.g. from another machine, to this one.
+
+The paths of the other DB are stored on the volume given with --volume,
+/home/user/img.jpg becomes laptop:/home/user/img.jpg. Paths that are
+already on a volume are kept as is. If both DBs have the same path,
+the most recently hashed row is kept.
+
+Commands run without a directory, like dupes, cover all volumes.`,
+	Run: merge,
+}
+
+func init() {
+	dbCmd.AddCommand(mergeCmd)
+
+	dbPath := defaultDBPath()
+
+	mergeCmd.Flags().String("db", dbPath, "DB file to use")
+	mergeCmd.Flags().String("volume", "", "Host or volume name to store the other DB's paths on")
+	mergeCmd.MarkFlagRequired("volume")
+}
+
+func merge(cmd *cobra.Command, args []string) {
+	viper.AutomaticEnv()
+
+	viper.BindPFlag("db", cmd.Flags().Lookup("db"))
+	viper.BindPFlag("volume", cmd.Flags().Lookup("volume"))
+
+	volume := viper.GetString("volume")
+	if !file.ValidVolumeName(volume) {
+		log.Fatalf("invalid volume name: %s", volume)
+	}
+
+	log.Infof("Using database %s\n", viper.GetString("db"))
+
+	openStore()
+	defer store.Close()
+
+	res, err := store.Merge(args[0], volume)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("Merged %s: %d added, %d updated, %d kept\n", args[0], res.Added, res.Updated, res.Kept)
+}
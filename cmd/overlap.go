@@ -0,0 +1,155 @@
+/*
+Copyright © 2026 Riku Lindblad <riku.lindblad@iki.fi>
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/lepinkainen/godupe/db"
+	"github.com/lepinkainen/godupe/progress"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// overlapCmd represents the overlap command
+var overlapCmd = &cobra.Command{
+	Use:   "overlap [directory]",
+	Args:  cobra.MaximumNArgs(1),
+	Short: "List files sharing parts of their content",
+	Long: `List pairs of files sharing a large fraction of their content, like
+VM images, appended logs or edited videos, that full file hashes miss.
+
+Files are compared by their content defined chunks, they need to be
+scanned with 'scan --chunks' first. The overlap is the fraction of the
+smaller file found in the other one. Identical files are listed by
+'dupes' instead.
+
+The block level savings are the bytes that would be saved if every
+distinct chunk was stored only once, like on a deduplicating file system.`,
+	Run: overlap,
+}
+
+func init() {
+	rootCmd.AddCommand(overlapCmd)
+
+	dbPath := defaultDBPath()
+
+	overlapCmd.Flags().String("db", dbPath, "DB file to use")
+	overlapCmd.Flags().Float64("min-overlap", 0.5, "Minimum fraction of the smaller file shared with the other (0-1)")
+	overlapCmd.Flags().String("format", "text", "Output format: text or json")
+}
+
+// overlapPair is a pair of files sharing chunks
+type overlapPair struct {
+	A       string  `json:"a"`
+	B       string  `json:"b"`
+	SizeA   int64   `json:"size_a"`
+	SizeB   int64   `json:"size_b"`
+	Shared  int64   `json:"shared"`
+	Overlap float64 `json:"overlap"`
+}
+
+type overlapResult struct {
+	Pairs []overlapPair `json:"pairs"`
+	// Total size of the chunked files
+	Total int64 `json:"total"`
+	// Bytes saved by storing every distinct chunk once
+	Savings int64 `json:"savings"`
+}
+
+// filterOverlaps returns the pairs sharing at least min of the smaller file, largest overlaps first
+func filterOverlaps(overlaps []db.Overlap, min float64) []overlapPair {
+	pairs := []overlapPair{}
+	for _, o := range overlaps {
+		// Identical files are duplicates
+		if o.Shared == o.SizeA && o.Shared == o.SizeB {
+			continue
+		}
+		smaller := o.SizeA
+		if o.SizeB < smaller {
+			smaller = o.SizeB
+		}
+		if smaller == 0 {
+			continue
+		}
+
+		fraction := float64(o.Shared) / float64(smaller)
+		if fraction < min {
+			continue
+		}
+		pairs = append(pairs, overlapPair{A: o.A, B: o.B, SizeA: o.SizeA, SizeB: o.SizeB, Shared: o.Shared, Overlap: fraction})
+	}
+
+	sort.SliceStable(pairs, func(i, j int) bool {
+		if pairs[i].Overlap != pairs[j].Overlap {
+			return pairs[i].Overlap > pairs[j].Overlap
+		}
+		return pairs[i].Shared > pairs[j].Shared
+	})
+
+	return pairs
+}
+
+func printOverlaps(res overlapResult, format string) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(res)
+	case "text":
+		for _, p := range res.Pairs {
+			fmt.Printf("%.0f%% overlap (%s shared):\n", p.Overlap*100, progress.FormatBytes(p.Shared))
+			fmt.Printf("  %s (%s)\n", p.A, progress.FormatBytes(p.SizeA))
+			fmt.Printf("  %s (%s)\n", p.B, progress.FormatBytes(p.SizeB))
+		}
+		fmt.Printf("%d pairs, %s in chunked files, %s saved by block level dedupe\n", len(res.Pairs),
+			progress.FormatBytes(res.Total), progress.FormatBytes(res.Savings))
+		return nil
+	default:
+		return fmt.Errorf("unknown format: %s", format)
+	}
+}
+
+func overlap(cmd *cobra.Command, args []string) {
+	viper.AutomaticEnv()
+
+	viper.BindPFlag("db", cmd.Flags().Lookup("db"))
+	viper.BindPFlag("min-overlap", cmd.Flags().Lookup("min-overlap"))
+	viper.BindPFlag("format", cmd.Flags().Lookup("format"))
+
+	min := viper.GetFloat64("min-overlap")
+	if min < 0 || min > 1 {
+		log.Fatalf("--min-overlap must be between 0 and 1: %v", min)
+	}
+
+	log.Infof("Using database %s\n", viper.GetString("db"))
+
+	openStore()
+	defer store.Close()
+
+	root := rootArg(args)
+
+	total, unique, err := store.ChunkUsage(root)
+	if err != nil {
+		log.Fatal(err)
+	}
+	overlaps, err := store.Overlaps(root)
+	if err != nil {
+		log.Fatal(err)
+	}
+	res := overlapResult{
+		Pairs:   filterOverlaps(overlaps, min),
+		Total:   total,
+		Savings: total - unique,
+	}
+
+	err = printOverlaps(res, viper.GetString("format"))
+	if err != nil {
+		log.Fatal(err)
+	}
+}
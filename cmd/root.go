@@ -24,7 +24,12 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 
+	"github.com/lepinkainen/godupe/file"
+	"github.com/lepinkainen/godupe/godupe"
+	"github.com/lepinkainen/godupe/metrics"
+	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 
 	homedir "github.com/mitchellh/go-homedir"
@@ -46,13 +51,22 @@ to quickly create a Cobra application.`,
 	// Uncomment the following line if your bare application
 	// has an action associated with it:
 	//	Run: func(cmd *cobra.Command, args []string) { },
+	PersistentPreRun:  setupLogging,
+	PersistentPostRun: logSummary,
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
-	if err := rootCmd.Execute(); err != nil {
-		fmt.Println(err)
+	cmd, err := rootCmd.ExecuteC()
+	if err != nil {
+		if runStart.IsZero() {
+			fmt.Fprintln(os.Stderr, err)
+		} else {
+			// PersistentPostRun isn't run when the command fails
+			log.Error(err)
+			logSummary(cmd, nil)
+		}
 		os.Exit(1)
 	}
 }
@@ -65,7 +79,15 @@ func init() {
 	// will be global for your application.
 
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.godupe.yaml)")
-	rootCmd.PersistentFlags().BoolP("verbose", "v", false, "verbose output")
+	rootCmd.PersistentFlags().BoolP("verbose", "v", false, "verbose output, same as --log-level debug")
+	rootCmd.PersistentFlags().String("log-level", "info", "Minimum level of logged messages: debug, info, warn or error")
+	rootCmd.PersistentFlags().String("log-format", "text", "Log format: text or json")
+	rootCmd.PersistentFlags().String("log-file", "", "File to append the log to (default stderr)")
+
+	viper.BindPFlag("verbose", rootCmd.PersistentFlags().Lookup("verbose"))
+	viper.BindPFlag("log-level", rootCmd.PersistentFlags().Lookup("log-level"))
+	viper.BindPFlag("log-format", rootCmd.PersistentFlags().Lookup("log-format"))
+	viper.BindPFlag("log-file", rootCmd.PersistentFlags().Lookup("log-file"))
 
 	// Cobra also supports local flags, which will only run
 	// when this action is called directly.
@@ -82,7 +104,7 @@ func initConfig() {
 		// Find home directory.
 		home, err := homedir.Dir()
 		if err != nil {
-			fmt.Println(err)
+			fmt.Fprintln(os.Stderr, err)
 			os.Exit(1)
 		}
 
@@ -95,6 +117,91 @@ func initConfig() {
 
 	// If a config file is found, read it in.
 	if err := viper.ReadInConfig(); err == nil {
-		fmt.Println("Using config file:", viper.ConfigFileUsed())
+		fmt.Fprintln(os.Stderr, "Using config file:", viper.ConfigFileUsed())
+	}
+}
+
+// defaultDBPath returns the path of the DB in the user's configuration directory,
+// creating the directory if needed
+func defaultDBPath() string {
+	// Get user's configuration directory
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error getting configuration directory:", err)
+		return "godupe.db"
+	}
+
+	// Create the godupe directory if it doesn't exist
+	godupeDir := filepath.Join(configDir, "godupe")
+	err = os.MkdirAll(godupeDir, os.ModePerm)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error creating directory:", err)
+		return "godupe.db"
+	}
+
+	// Construct the full path to the database file
+	return filepath.Join(godupeDir, "godupe.db")
+}
+
+// rootArg returns the path given as the first argument as stored in the DB,
+// or an empty root for the whole DB. Paths on other volumes are used as is.
+func rootArg(args []string) string {
+	if len(args) == 0 {
+		return ""
+	}
+	if _, _, ok := file.SplitVolumePath(args[0]); ok {
+		return args[0]
+	}
+
+	root, err := filepath.Abs(args[0])
+	if err != nil {
+		log.Fatal(err)
+	}
+	return volumes.DBPath(root)
+}
+
+// store is the DB used by the running command
+var store *godupe.Store
+
+// volumes maps local paths to paths on the mounted volumes
+var volumes *godupe.Volumes
+
+// openStore opens the DB given with --db and finds the mounted volumes
+func openStore() {
+	var err error
+	store, err = godupe.OpenStore(godupe.StoreOptions{Path: viper.GetString("db")})
+	if err != nil {
+		log.Fatal(err)
+	}
+	volumes, err = godupe.LoadVolumes(store)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// storedTree returns the stored files under root and root itself, if it's a stored file
+func storedTree(root string) ([]godupe.Entry, error) {
+	entries, err := store.Tree(root)
+	if err != nil {
+		return nil, err
+	}
+	e, ok, err := store.Lookup(root)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// serveMetrics serves the Prometheus metrics on the address given with --metrics-listen, if any
+func serveMetrics() {
+	addr := viper.GetString("metrics-listen")
+	if addr == "" {
+		return
+	}
+	if err := metrics.Listen(addr); err != nil {
+		log.Fatal(err)
 	}
 }
@@ -22,18 +22,14 @@ THE SOFTWARE.
 package cmd
 
 import (
-	"fmt"
 	"io/fs"
 	"os"
-	"path/filepath"
 
 	log "github.com/sirupsen/logrus"
 
-	"github.com/lepinkainen/godupe/db"
-	"github.com/lepinkainen/godupe/file"
-
-	// We're using sqlite for the DB
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/lepinkainen/godupe/godupe"
+	"github.com/lepinkainen/godupe/progress"
+	"github.com/lepinkainen/godupe/remote"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -44,9 +40,26 @@ var scanCmd = &cobra.Command{
 	Use:   "scan [directory]",
 	Args:  cobra.MinimumNArgs(1),
 	Short: "Scan and add file checksums to DB",
-	Run:   scan,
+	Long: `Scan and add file checksums to DB.
+
+Directories on other machines can be scanned over SFTP with
+sftp://[user@]host[:port]/path, the files are stored on a volume named
+after the host. Host keys are checked against ~/.ssh/known_hosts and
+the keys from the SSH agent and ~/.ssh are used to log in.
+
+Buckets in S3 compatible object storage can be scanned with
+s3://bucket/prefix, the objects are stored on a volume named after the
+bucket. Objects uploaded with SHA-256 checksums and copies of already
+hashed objects, found by their MD5 ETags, aren't downloaded. Local and
+SFTP files only match ETags if they were scanned with --md5. Credentials
+are read from the AWS_ or MINIO_ environment variables or
+~/.aws/credentials.`,
+	Run: scan,
 }
 
+// reporter shows aggregate progress for the running scan, nil if disabled
+var reporter *progress.Reporter
+
 func init() {
 	rootCmd.AddCommand(scanCmd)
 
@@ -56,23 +69,7 @@ func init() {
 	// and all subcommands, e.g.:
 	// scanCmd.PersistentFlags().String("foo", "", "A help for foo")
 
-	// Get user's configuration directory
-	configDir, err := os.UserConfigDir()
-	if err != nil {
-		fmt.Println("Error getting configuration directory:", err)
-		return
-	}
-
-	// Create the godupe directory if it doesn't exist
-	godupeDir := filepath.Join(configDir, "godupe")
-	err = os.MkdirAll(godupeDir, os.ModePerm)
-	if err != nil {
-		fmt.Println("Error creating directory:", err)
-		return
-	}
-
-	// Construct the full path to the database file
-	dbPath := filepath.Join(godupeDir, "godupe.db")
+	dbPath := defaultDBPath()
 
 	// Cobra supports local flags which will only run when this command
 	// is called directly, e.g.:
@@ -80,207 +77,166 @@ func init() {
 	scanCmd.Flags().String("db", dbPath, "DB file to use")
 	scanCmd.Flags().Int64("limit", 2, "Amount of MiB to read when doing partial scan")
 	scanCmd.Flags().Bool("cache", false, "Cache processed files to a file")
+	scanCmd.Flags().Bool("progress", true, "Show overall progress of the scan")
+	scanCmd.Flags().Bool("precount", true, "Count files before scanning to estimate time remaining")
+	scanCmd.Flags().Bool("images", false, "Also store perceptual hashes of JPEG, PNG and GIF images")
+	scanCmd.Flags().Bool("archives", false, "Also hash files inside zip and tar archives")
+	scanCmd.Flags().String("symlinks", "skip", "How to handle symbolic links: skip, follow or record")
+	scanCmd.Flags().Bool("volume", false, "Store paths relative to the removable or network drive holding the directory")
+	scanCmd.Flags().Bool("xattrs", false, "Store hashes in the extended attributes of the files and trust them on rescans if the file hasn't changed")
+	scanCmd.Flags().Bool("chunks", false, "Also store content defined chunks of the files to find partially overlapping files, see the overlap command")
+	scanCmd.Flags().Int("chunk-size", 64, "Average chunk size in KiB, rounded down to a power of two")
+	scanCmd.Flags().Bool("md5", false, "Also store MD5s of fully read files, so copies of them in S3 are found by their ETags")
+	scanCmd.Flags().String("metrics-listen", "", "Serve Prometheus metrics at /metrics on this address during the scan, e.g. :9101")
+	scanCmd.Flags().String("ssh-key", "", "Private key to log in with when scanning over SFTP")
+	scanCmd.Flags().String("s3-endpoint", "", "S3 service to scan buckets on, e.g. http://localhost:9000 (default $AWS_ENDPOINT_URL or s3.amazonaws.com)")
+	scanCmd.Flags().String("known-hosts", "", "Known hosts file to check SFTP host keys against (default ~/.ssh/known_hosts)")
 }
 
-func walkDirFunc(path string, d fs.DirEntry, err error) error {
-	if err != nil {
-		log.Errorf("Error accessing directory: %s\n", path)
-		return err
-	}
-	abspath, err := filepath.Abs(path)
-	if err != nil {
-		log.Errorf("Error getting absolute path for %s: %s\n", path, err)
-	}
+func scan(cmd *cobra.Command, args []string) {
 
-	var hasSubdirs = false
+	viper.AutomaticEnv()
 
-	// If this is a directory, check for subdirs and set flag
-	if d.IsDir() {
-		hasSubdirs, err = file.HasSubdirectories(abspath)
-		if err != nil {
-			log.Errorf("error determining subdirectories %v", err)
-			return err
-		}
-	}
+	viper.BindPFlag("partial", cmd.Flags().Lookup("partial"))
+	viper.BindPFlag("db", cmd.Flags().Lookup("db"))
+	viper.BindPFlag("limit", cmd.Flags().Lookup("limit"))
+	viper.BindPFlag("cache", cmd.Flags().Lookup("cache"))
+	viper.BindPFlag("progress", cmd.Flags().Lookup("progress"))
+	viper.BindPFlag("precount", cmd.Flags().Lookup("precount"))
+	viper.BindPFlag("images", cmd.Flags().Lookup("images"))
+	viper.BindPFlag("archives", cmd.Flags().Lookup("archives"))
+	viper.BindPFlag("symlinks", cmd.Flags().Lookup("symlinks"))
+	viper.BindPFlag("volume", cmd.Flags().Lookup("volume"))
+	viper.BindPFlag("xattrs", cmd.Flags().Lookup("xattrs"))
+	viper.BindPFlag("chunks", cmd.Flags().Lookup("chunks"))
+	viper.BindPFlag("chunk-size", cmd.Flags().Lookup("chunk-size"))
+	viper.BindPFlag("md5", cmd.Flags().Lookup("md5"))
+	viper.BindPFlag("metrics-listen", cmd.Flags().Lookup("metrics-listen"))
+	viper.BindPFlag("ssh-key", cmd.Flags().Lookup("ssh-key"))
+	viper.BindPFlag("known-hosts", cmd.Flags().Lookup("known-hosts"))
+	viper.BindPFlag("s3-endpoint", cmd.Flags().Lookup("s3-endpoint"))
 
-	if viper.GetBool("cache") {
-		cachedDirs := file.LoadCachedDirs()
+	//const mib = 1048576 // 1 MiB
+	//const partialSize = 2 * mib
 
-		// Skip if directory is in cache and doesn't have subdirectories
-		// else the subrids will never be processed
-		if !hasSubdirs {
-			if d.IsDir() && file.ContainsDir(cachedDirs, abspath) {
-				log.Infof("Skipping cached directory: %s (no subdirectories)", abspath)
-				return filepath.SkipDir
-			}
-		}
+	log.Infof("Using database %s\n", viper.GetString("db"))
+	if viper.GetBool("partial") {
+		log.Infoln("Running partial scan")
 	}
 
-	// Skip if all files are already in database
-	if d.IsDir() {
-
-		files, err := file.WalkDirFiles(path)
-		log.Infof("processing: %s [%d files]\n", abspath, len(files))
-		if err != nil {
-			return err
-		}
-
-		skip := db.ExistsAll(files)
+	openStore()
+	defer store.Close()
+	serveMetrics()
 
-		// skip directories that have been fully processed (every file exists in DB)
-		if skip {
-			log.Debug("-> Skip - already processed")
+	if remote.IsSFTP(args[0]) {
+		scanSFTP(args[0])
+		return
+	}
+	if remote.IsS3(args[0]) {
+		scanS3(args[0])
+		return
+	}
 
-			if viper.GetBool("cache") {
-				log.Infof("Caching: %s", abspath)
-				file.AddDirToCache(abspath)
-			}
+	err := volumes.Register(args[0], viper.GetBool("volume"))
+	if err != nil {
+		log.Fatal(err)
+	}
 
-			// only fully skip directories with no subdirs
-			if !hasSubdirs {
-				return filepath.SkipDir
-			} else {
-				return nil
+	if viper.GetBool("progress") {
+		reporter = progress.New(os.Stdout)
+		if viper.GetBool("precount") {
+			if err := reporter.Count(args[0]); err != nil {
+				log.Errorf("Error counting files in %s: %s\n", args[0], err)
 			}
 		}
-
-		// don't process directories in general
-		return nil
+		reporter.Start()
+		defer reporter.Finish()
 	}
 
-	// Handle potential panics during file access
-	defer func() {
-		if x := recover(); x != nil {
-			log.Errorf("Unreadable file: %s\n", path)
-			log.Errorf("Recovered in %s", x)
-		}
-	}()
+	err = newScanner(nil, "").Scan(args[0])
+	if err != nil {
+		log.Error(err)
+	}
+}
 
-	absfilepath, err := filepath.Abs(path)
+// scanSFTP hashes a directory on another machine over SFTP,
+// the files are stored on a volume named after the host
+func scanSFTP(rawURL string) {
+	conn, err := remote.DialSFTP(rawURL, remote.SSHOptions{
+		KeyFile:    viper.GetString("ssh-key"),
+		KnownHosts: viper.GetString("known-hosts"),
+	})
 	if err != nil {
-		log.Errorf("Error getting absolute path for %s: %s\n", path, err)
-		return err
+		log.Fatal(err)
 	}
+	defer conn.Close()
 
-	partial := viper.GetBool("partial")
+	log.Infof("Scanning %s on volume %s", conn.Dir(), conn.Host())
 
-	// Check if file already exists based on hash type
-	res := db.Exists(absfilepath)
-	if (partial && (res == db.HashTypePartial || res == db.HashTypeFull)) ||
-		(!partial && res == db.HashTypeFull) {
-		log.Debugf("skipping: %s\n", path)
-		return nil
+	// Counting the files first would walk the remote directories twice
+	if viper.GetBool("progress") {
+		reporter = progress.New(os.Stdout)
+		reporter.Start()
+		defer reporter.Finish()
 	}
 
-	// Perform file operations
-	filename, size, hash, err := file.Hash(path)
+	err = newScanner(conn.FS(), conn.Host()).Scan(conn.Dir())
 	if err != nil {
-		log.Errorf("Error hashing file %s: %s\n", path, err)
-		return err
-	}
-
-	// Skip empty files
-	if size == 0 {
-		log.Debugf("skipping empty file: %s\n", path)
-		return nil
+		log.Error(err)
 	}
-
-	db.Save(filename, size, hash)
-
-	return nil
 }
 
-func walkFunc(path string, info os.FileInfo, err error) error {
-	// handle situations when a file isn't really a file or directory
-	// usually files with really weird filenames on network drives
-	defer func() {
-		if x := recover(); x != nil {
-			log.Errorf("Unreadable file: %s\n", path)
-			log.Errorf("Recovered in %s", x)
-		}
-	}()
-	partial := viper.GetBool("partial")
+// newHasher creates a hasher configured by the partial and limit flags
+func newHasher() *godupe.Hasher {
+	return godupe.NewHasher(godupe.HasherOptions{
+		Partial:     viper.GetBool("partial"),
+		PartialSize: viper.GetInt64("limit") * 1048576,
+	})
+}
 
+// scanS3 hashes the objects in a bucket, they are stored on a volume named after the bucket
+func scanS3(rawURL string) {
+	bucket, err := remote.OpenS3(rawURL, remote.S3Options{Endpoint: viper.GetString("s3-endpoint")})
 	if err != nil {
-		log.Errorf("Error walking directory: %s\n", path)
-		return err
+		log.Fatal(err)
 	}
 
-	// We can't do anything to directories
-	if info.IsDir() {
-		log.Infof("processing: %s\n", path)
-		return nil
-	}
-
-	// TODO: maybe load the full list of stuff to memory to speed up the process?
-	// TODO: is is possible to remember stuff in a recursive function?
-	// Benchmark it?
-	absfilepath, _ := filepath.Abs(path)
-	res := db.Exists(absfilepath)
-	// if we are doing partial hashes and partial or full hash exists, skip
-
-	if partial {
-		if res == db.HashTypePartial || res == db.HashTypeFull {
-			log.Debugf("skipping: %s\n", path)
-			return nil
-		}
-	} else {
-		// for full hash mode, we require the full hash, if we only have a partial, recalculate
-		if res == db.HashTypeFull {
-			log.Debugf("skipping: %s\n", path)
-			return nil
-		}
-	}
-
-	// TODO: Add a goroutine for hashing in parallel?
-	// TODO: Maybe with a configurable amount of workers and a limited channel size
-	if partial {
-		log.Debugf("hashing (partial): %s\n", path)
-	} else {
-		log.Debugf("hashing: %s\n", path)
+	log.Infof("Scanning %s on volume %s", bucket.Dir(), bucket.Bucket())
 
+	// Counting the objects first would list the bucket twice
+	if viper.GetBool("progress") {
+		reporter = progress.New(os.Stdout)
+		reporter.Start()
+		defer reporter.Finish()
 	}
 
-	// TODO: This is a complete hack, the f.Stat call should be done here
-	filename, size, hash, err := file.Hash(path)
+	err = newScanner(bucket.FS(), bucket.Bucket()).Scan(bucket.Dir())
 	if err != nil {
-		log.Errorf("Error hashing file %s: %s\n", path, err)
-		return err
-	}
-
-	// skip small files for now
-	if size == 0 {
-		log.Debugf("skipping empty file: %s\n", path)
-		return nil
+		log.Error(err)
 	}
-
-	db.Save(filename, size, hash)
-
-	return nil
 }
 
-func scan(cmd *cobra.Command, args []string) {
-
-	viper.AutomaticEnv()
-
-	viper.BindPFlag("partial", cmd.Flags().Lookup("partial"))
-	viper.BindPFlag("db", cmd.Flags().Lookup("db"))
-	viper.BindPFlag("limit", cmd.Flags().Lookup("limit"))
-	viper.BindPFlag("cache", cmd.Flags().Lookup("cache"))
-
-	//const mib = 1048576 // 1 MiB
-	//const partialSize = 2 * mib
-
-	if viper.GetBool("verbose") {
-		log.SetLevel(log.DebugLevel)
-	}
-
-	log.Infof("Using database %s\n", viper.GetString("db"))
-	if viper.GetBool("partial") {
-		log.Infoln("Running partial scan")
+// newScanner creates a scanner configured by the scan flags. fsys is
+// scanned instead of the local file system if given, stored on volume
+func newScanner(fsys fs.FS, volume string) *godupe.Scanner {
+	scanner, err := godupe.NewScanner(godupe.ScannerOptions{
+		Store:     store,
+		Hasher:    newHasher(),
+		Volumes:   volumes,
+		Progress:  reporter,
+		Images:    viper.GetBool("images"),
+		Archives:  viper.GetBool("archives"),
+		Symlinks:  viper.GetString("symlinks"),
+		Cache:     viper.GetBool("cache"),
+		Xattrs:    viper.GetBool("xattrs"),
+		Chunks:    viper.GetBool("chunks"),
+		ChunkSize: viper.GetInt("chunk-size") * 1024,
+		MD5:       viper.GetBool("md5"),
+		FS:        fsys,
+		Volume:    volume,
+	})
+	if err != nil {
+		log.Fatal(err)
 	}
-
-	db.Init()
-	//filepath.Walk(args[0], walkFunc)
-	filepath.WalkDir(args[0], walkDirFunc)
+	return scanner
 }
@@ -0,0 +1,172 @@
+/*
+Copyright © 2026 Riku Lindblad <riku.lindblad@iki.fi>
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/lepinkainen/godupe/db"
+	"github.com/lepinkainen/godupe/imagehash"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// similarCmd represents the similar command
+var similarCmd = &cobra.Command{
+	Use:   "similar [directory]",
+	Args:  cobra.MaximumNArgs(1),
+	Short: "Find similar files",
+	Long: `Find files that are similar, but not necessarily identical.
+
+With --images, images are grouped by the Hamming distance of their
+perceptual hashes, finding resized and re-encoded copies.
+Images need to be scanned with 'scan --images' first.`,
+	Run: similar,
+}
+
+func init() {
+	rootCmd.AddCommand(similarCmd)
+
+	dbPath := defaultDBPath()
+
+	similarCmd.Flags().String("db", dbPath, "DB file to use")
+	similarCmd.Flags().Bool("images", false, "Find similar images")
+	similarCmd.Flags().Int("threshold", 8, "Maximum Hamming distance between similar images (0-64)")
+	similarCmd.Flags().String("algorithm", "phash", "Perceptual hash to compare: phash or dhash")
+	similarCmd.Flags().String("format", "text", "Output format: text or json")
+}
+
+// similarGroup is a group of images within the threshold of each other
+type similarGroup struct {
+	// Largest distance from the first image in the group
+	MaxDistance int      `json:"max_distance"`
+	Paths       []string `json:"paths"`
+}
+
+// groupSimilarImages groups images transitively: two images end up in the same
+// group if there's a chain of images within the threshold between them
+func groupSimilarImages(images []db.Image, algorithm string, threshold int) []similarGroup {
+	tree := &imagehash.BKTree{}
+	hashes := map[string]uint64{}
+
+	for _, img := range images {
+		s := img.PHash
+		if algorithm == "dhash" {
+			s = img.DHash
+		}
+		hash, err := imagehash.Parse(s)
+		if err != nil {
+			log.Warnf("Invalid %s for %s: %s", algorithm, img.Path, err)
+			continue
+		}
+		hashes[img.Path] = hash
+		tree.Add(hash, img.Path)
+	}
+
+	// union-find over paths
+	parent := map[string]string{}
+	var find func(string) string
+	find = func(p string) string {
+		if parent[p] == "" || parent[p] == p {
+			return p
+		}
+		parent[p] = find(parent[p])
+		return parent[p]
+	}
+
+	for path, hash := range hashes {
+		for _, m := range tree.Search(hash, threshold) {
+			a, b := find(path), find(m.Item)
+			if a != b {
+				parent[a] = b
+			}
+		}
+	}
+
+	members := map[string][]string{}
+	for path := range hashes {
+		root := find(path)
+		members[root] = append(members[root], path)
+	}
+
+	groups := []similarGroup{}
+	for _, paths := range members {
+		if len(paths) < 2 {
+			continue
+		}
+		sort.Strings(paths)
+
+		group := similarGroup{Paths: paths}
+		for _, p := range paths[1:] {
+			if d := imagehash.Distance(hashes[paths[0]], hashes[p]); d > group.MaxDistance {
+				group.MaxDistance = d
+			}
+		}
+		groups = append(groups, group)
+	}
+
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Paths[0] < groups[j].Paths[0] })
+
+	return groups
+}
+
+func printSimilar(groups []similarGroup, format string) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(groups)
+	case "text":
+		for _, group := range groups {
+			fmt.Printf("Similar (%d images, distance %d):\n", len(group.Paths), group.MaxDistance)
+			for _, path := range group.Paths {
+				fmt.Printf("  %s\n", path)
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown format: %s", format)
+	}
+}
+
+func similar(cmd *cobra.Command, args []string) {
+	viper.AutomaticEnv()
+
+	viper.BindPFlag("db", cmd.Flags().Lookup("db"))
+	viper.BindPFlag("images", cmd.Flags().Lookup("images"))
+	viper.BindPFlag("threshold", cmd.Flags().Lookup("threshold"))
+	viper.BindPFlag("algorithm", cmd.Flags().Lookup("algorithm"))
+	viper.BindPFlag("format", cmd.Flags().Lookup("format"))
+
+	if !viper.GetBool("images") {
+		log.Fatal("nothing to compare, use --images")
+	}
+
+	algorithm := viper.GetString("algorithm")
+	if algorithm != "phash" && algorithm != "dhash" {
+		log.Fatalf("unknown algorithm: %s", algorithm)
+	}
+
+	log.Infof("Using database %s\n", viper.GetString("db"))
+
+	openStore()
+	defer store.Close()
+
+	root := rootArg(args)
+
+	images, err := store.Images(root)
+	if err != nil {
+		log.Fatal(err)
+	}
+	groups := groupSimilarImages(images, algorithm, viper.GetInt("threshold"))
+
+	err = printSimilar(groups, viper.GetString("format"))
+	if err != nil {
+		log.Fatal(err)
+	}
+}
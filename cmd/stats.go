@@ -0,0 +1,263 @@
+/*
+Copyright © 2026 Riku Lindblad <riku.lindblad@iki.fi>
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/lepinkainen/godupe/db"
+	"github.com/lepinkainen/godupe/progress"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// statsCmd represents the stats command
+var statsCmd = &cobra.Command{
+	Use:   "stats [directory]",
+	Args:  cobra.MaximumNArgs(1),
+	Short: "Show statistics of the DB",
+	Long: `Show the amount of files and bytes in the DB, how they have been
+hashed, the duplicates and the space they take, the directories with the
+most duplicated bytes, a histogram of the file sizes and the file types.
+
+Duplicated bytes of a directory are the bytes of the files directly in
+it that have a copy somewhere else, hardlinks and symlinks don't count.
+
+Only the given directory is counted, the default is the whole DB
+including merged volumes.`,
+	Run: stats,
+}
+
+func init() {
+	rootCmd.AddCommand(statsCmd)
+
+	dbPath := defaultDBPath()
+
+	statsCmd.Flags().String("db", dbPath, "DB file to use")
+	statsCmd.Flags().Int("top", 10, "Amount of directories and file types to list")
+	statsCmd.Flags().String("format", "text", "Output format: text or json")
+}
+
+// sizeBuckets are the upper bounds of the size histogram buckets, the last one is open
+var sizeBuckets = []int64{4 << 10, 64 << 10, 1 << 20, 16 << 20, 256 << 20, 4 << 30}
+
+// statsCount is an amount of files and their total size
+type statsCount struct {
+	Files int   `json:"files"`
+	Bytes int64 `json:"bytes"`
+}
+
+func (c *statsCount) add(size int64) {
+	c.Files++
+	c.Bytes += size
+}
+
+// statsDir is a directory with duplicated bytes
+type statsDir struct {
+	Path string `json:"path"`
+	statsCount
+}
+
+// statsBucket is a bucket of the size histogram, files from Min up to Max bytes
+type statsBucket struct {
+	Min int64 `json:"min"`
+	// Zero for the last bucket
+	Max int64 `json:"max,omitempty"`
+	statsCount
+}
+
+// statsType is the files with the same extension
+type statsType struct {
+	Extension string `json:"extension"`
+	statsCount
+}
+
+type statsResult struct {
+	Files int   `json:"files"`
+	Bytes int64 `json:"bytes"`
+	// Files by the HashType of their rows
+	Full     statsCount `json:"full"`
+	Partial  statsCount `json:"partial"`
+	Unhashed statsCount `json:"unhashed"`
+
+	DuplicateGroups int   `json:"duplicate_groups"`
+	DuplicateFiles  int   `json:"duplicate_files"`
+	Reclaimable     int64 `json:"reclaimable"`
+
+	TopDirs []statsDir    `json:"top_dirs"`
+	Sizes   []statsBucket `json:"sizes"`
+	Types   []statsType   `json:"types"`
+}
+
+// fileType returns the lowercase extension of a file, "(none)" without one
+func fileType(path string) string {
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext == "" || strings.ContainsAny(ext, "/!") {
+		return "(none)"
+	}
+	return ext
+}
+
+// collectStats counts the stored entries and the duplicate groups built from them
+func collectStats(entries []db.Entry, dupes dupesResult, top int) statsResult {
+	res := statsResult{TopDirs: []statsDir{}, Types: []statsType{}}
+
+	res.Sizes = make([]statsBucket, len(sizeBuckets)+1)
+	for i := range res.Sizes {
+		if i > 0 {
+			res.Sizes[i].Min = sizeBuckets[i-1]
+		}
+		if i < len(sizeBuckets) {
+			res.Sizes[i].Max = sizeBuckets[i]
+		}
+	}
+
+	types := map[string]*statsCount{}
+	for _, e := range entries {
+		res.Files++
+		res.Bytes += e.Size
+
+		switch e.HashType() {
+		case db.HashTypeFull:
+			res.Full.add(e.Size)
+		case db.HashTypePartial:
+			res.Partial.add(e.Size)
+		default:
+			res.Unhashed.add(e.Size)
+		}
+
+		bucket := sort.Search(len(sizeBuckets), func(i int) bool { return e.Size < sizeBuckets[i] })
+		res.Sizes[bucket].add(e.Size)
+
+		ext := fileType(e.Path)
+		if types[ext] == nil {
+			types[ext] = &statsCount{}
+		}
+		types[ext].add(e.Size)
+	}
+
+	dirs := map[string]*statsCount{}
+	for _, group := range dupes.Groups {
+		res.DuplicateGroups++
+		for _, f := range group.Files {
+			if f.HardlinkOf != "" || f.SymlinkTo != "" {
+				continue
+			}
+			res.DuplicateFiles++
+
+			dir := filepath.Dir(f.Path)
+			if dirs[dir] == nil {
+				dirs[dir] = &statsCount{}
+			}
+			dirs[dir].add(group.Size)
+		}
+	}
+	res.Reclaimable = dupes.Reclaimable
+
+	for path, c := range dirs {
+		res.TopDirs = append(res.TopDirs, statsDir{Path: path, statsCount: *c})
+	}
+	sort.Slice(res.TopDirs, func(i, j int) bool {
+		if res.TopDirs[i].Bytes != res.TopDirs[j].Bytes {
+			return res.TopDirs[i].Bytes > res.TopDirs[j].Bytes
+		}
+		return res.TopDirs[i].Path < res.TopDirs[j].Path
+	})
+	if len(res.TopDirs) > top {
+		res.TopDirs = res.TopDirs[:top]
+	}
+
+	for ext, c := range types {
+		res.Types = append(res.Types, statsType{Extension: ext, statsCount: *c})
+	}
+	sort.Slice(res.Types, func(i, j int) bool {
+		if res.Types[i].Bytes != res.Types[j].Bytes {
+			return res.Types[i].Bytes > res.Types[j].Bytes
+		}
+		return res.Types[i].Extension < res.Types[j].Extension
+	})
+	if len(res.Types) > top {
+		res.Types = res.Types[:top]
+	}
+
+	return res
+}
+
+func printStats(res statsResult, format string) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(res)
+	case "text":
+		fmt.Printf("Files:      %d (%s)\n", res.Files, progress.FormatBytes(res.Bytes))
+		fmt.Printf("  full:     %d (%s)\n", res.Full.Files, progress.FormatBytes(res.Full.Bytes))
+		fmt.Printf("  partial:  %d (%s)\n", res.Partial.Files, progress.FormatBytes(res.Partial.Bytes))
+		fmt.Printf("  unhashed: %d (%s)\n", res.Unhashed.Files, progress.FormatBytes(res.Unhashed.Bytes))
+		fmt.Printf("Duplicates: %d groups, %d files, %s reclaimable\n", res.DuplicateGroups, res.DuplicateFiles,
+			progress.FormatBytes(res.Reclaimable))
+
+		if len(res.TopDirs) > 0 {
+			fmt.Println("Top directories by duplicated bytes:")
+			for _, d := range res.TopDirs {
+				fmt.Printf("  %10s %6d  %s\n", progress.FormatBytes(d.Bytes), d.Files, d.Path)
+			}
+		}
+
+		fmt.Println("File sizes:")
+		for _, b := range res.Sizes {
+			bounds := fmt.Sprintf("%s - %s", progress.FormatBytes(b.Min), progress.FormatBytes(b.Max))
+			if b.Max == 0 {
+				bounds = fmt.Sprintf("%s -", progress.FormatBytes(b.Min))
+			}
+			fmt.Printf("  %-20s %8d %10s\n", bounds, b.Files, progress.FormatBytes(b.Bytes))
+		}
+
+		if len(res.Types) > 0 {
+			fmt.Println("File types:")
+			for _, t := range res.Types {
+				fmt.Printf("  %-10s %8d %10s\n", t.Extension, t.Files, progress.FormatBytes(t.Bytes))
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown format: %s", format)
+	}
+}
+
+func stats(cmd *cobra.Command, args []string) {
+	viper.AutomaticEnv()
+
+	viper.BindPFlag("db", cmd.Flags().Lookup("db"))
+	viper.BindPFlag("top", cmd.Flags().Lookup("top"))
+	viper.BindPFlag("format", cmd.Flags().Lookup("format"))
+
+	log.Infof("Using database %s\n", viper.GetString("db"))
+
+	openStore()
+	defer store.Close()
+
+	root := rootArg(args)
+
+	entries, err := store.Tree(root)
+	if err != nil {
+		log.Fatal(err)
+	}
+	dupes, err := store.Duplicates(root)
+	if err != nil {
+		log.Fatal(err)
+	}
+	res := collectStats(entries, groupDupes(dupes), viper.GetInt("top"))
+
+	err = printStats(res, viper.GetString("format"))
+	if err != nil {
+		log.Fatal(err)
+	}
+}
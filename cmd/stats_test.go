@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/lepinkainen/godupe/db"
+)
+
+func TestCollectStats(t *testing.T) {
+	entries := []db.Entry{
+		{Path: "/photos/a.JPG", Hash: "h1", Size: 100},
+		{Path: "/photos/b.jpg", Hash: "h1", Size: 100},
+		{Path: "/backup/a.jpg", Hash: "h1", Size: 100},
+		{Path: "/backup/video.mp4", PartialHash: "p1", Size: 100 << 20},
+		{Path: "/backup/notes", Size: 5000},
+		{Path: "/backup/files.zip!/dir.d/inner", Hash: "h2", Size: 10},
+	}
+	dupes := groupDupes(entries[:3])
+
+	res := collectStats(entries, dupes, 2)
+
+	if res.Files != 6 || res.Bytes != 300+100<<20+5000+10 {
+		t.Errorf("%d files, %d bytes", res.Files, res.Bytes)
+	}
+	if want := (statsCount{Files: 4, Bytes: 310}); res.Full != want {
+		t.Errorf("full %+v, want %+v", res.Full, want)
+	}
+	if res.Partial.Files != 1 || res.Unhashed.Files != 1 {
+		t.Errorf("%d partial, %d unhashed, want 1 and 1", res.Partial.Files, res.Unhashed.Files)
+	}
+	if res.DuplicateGroups != 1 || res.DuplicateFiles != 3 || res.Reclaimable != 200 {
+		t.Errorf("%d groups, %d files, %d bytes reclaimable, want 1, 3 and 200",
+			res.DuplicateGroups, res.DuplicateFiles, res.Reclaimable)
+	}
+
+	wantDirs := []statsDir{
+		{Path: "/photos", statsCount: statsCount{Files: 2, Bytes: 200}},
+		{Path: "/backup", statsCount: statsCount{Files: 1, Bytes: 100}},
+	}
+	if !reflect.DeepEqual(res.TopDirs, wantDirs) {
+		t.Errorf("top dirs %+v, want %+v", res.TopDirs, wantDirs)
+	}
+
+	// Cut to the top 2, the extension of an archive member isn't the directory's
+	wantTypes := []statsType{
+		{Extension: ".mp4", statsCount: statsCount{Files: 1, Bytes: 100 << 20}},
+		{Extension: "(none)", statsCount: statsCount{Files: 2, Bytes: 5010}},
+	}
+	if !reflect.DeepEqual(res.Types, wantTypes) {
+		t.Errorf("types %+v, want %+v", res.Types, wantTypes)
+	}
+
+	var histogram []int
+	for _, b := range res.Sizes {
+		histogram = append(histogram, b.Files)
+	}
+	if want := []int{4, 1, 0, 0, 1, 0, 0}; !reflect.DeepEqual(histogram, want) {
+		t.Errorf("size histogram %v, want %v", histogram, want)
+	}
+}
@@ -0,0 +1,228 @@
+/*
+Copyright © 2026 Riku Lindblad <riku.lindblad@iki.fi>
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"time"
+
+	"github.com/lepinkainen/godupe/db"
+	"github.com/lepinkainen/godupe/file"
+	"github.com/lepinkainen/godupe/progress"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// verifyCmd represents the verify command
+var verifyCmd = &cobra.Command{
+	Use:   "verify [path]",
+	Args:  cobra.MaximumNArgs(1),
+	Short: "Verify that stored files haven't been corrupted",
+	Long: `Rehash files in the DB and report the ones whose content no longer
+matches the stored full hash.
+
+Only files with the same size and modification time as when they were
+scanned are verified, changed files have been modified on purpose.
+Files scanned before modification times were stored need to be scanned
+again before they can be verified.
+
+Use --sample to verify a random percentage of the files and --rate to
+limit the read speed for periodic spot checks.
+
+Only the given file or directory is verified, the default is the whole DB.
+The exit status is 1 if any corrupted files were found.`,
+	RunE: verify,
+	// Corrupt files aren't a usage error, Execute logs the error
+	SilenceUsage:  true,
+	SilenceErrors: true,
+}
+
+func init() {
+	rootCmd.AddCommand(verifyCmd)
+
+	dbPath := defaultDBPath()
+
+	verifyCmd.Flags().String("db", dbPath, "DB file to use")
+	verifyCmd.Flags().Float64("sample", 100, "Percentage of files to verify")
+	verifyCmd.Flags().Int64("rate", 0, "Maximum read speed in MiB/s, 0 for unlimited")
+	verifyCmd.Flags().Bool("progress", false, "Show verification progress")
+	verifyCmd.Flags().String("format", "text", "Output format: text or json")
+}
+
+// throttle is an io.Writer that blocks to keep the bytes written under rate per second
+type throttle struct {
+	rate  int64
+	start time.Time
+	n     int64
+}
+
+func (t *throttle) Write(p []byte) (int, error) {
+	if t.start.IsZero() {
+		t.start = time.Now()
+	}
+	t.n += int64(len(p))
+
+	expected := time.Duration(float64(t.n) / float64(t.rate) * float64(time.Second))
+	if wait := expected - time.Since(t.start); wait > 0 {
+		time.Sleep(wait)
+	}
+	return len(p), nil
+}
+
+type verifyResult struct {
+	Corrupt  []string `json:"corrupt"`
+	Missing  []string `json:"missing"`
+	Verified int      `json:"verified"`
+	Bytes    int64    `json:"bytes"`
+	// Modified since the scan
+	Changed int `json:"changed"`
+	// No full hash or modification time stored
+	Unverifiable int `json:"unverifiable"`
+	// On volumes that aren't mounted
+	Offline int `json:"offline"`
+}
+
+// verifyEntries rehashes the unchanged files in entries and compares them to the stored hashes
+func verifyEntries(entries []db.Entry, sample float64, progressWriter io.Writer) verifyResult {
+	res := verifyResult{Corrupt: []string{}, Missing: []string{}}
+
+	for _, e := range entries {
+		// Links and archive members are verified through their targets and archives
+		if e.Target != "" {
+			continue
+		}
+		if _, _, ok := file.SplitArchivePath(e.Path); ok {
+			continue
+		}
+		path, ok := volumes.LocalPath(e.Path)
+		if !ok {
+			res.Offline++
+			continue
+		}
+		if e.Hash == "" || e.Mtime == 0 {
+			if e.Source != "" {
+				log.Debugf("Can't verify %s, the hash imported from %s was never checked\n", e.Path, e.Source)
+			} else {
+				log.Debugf("Can't verify %s, scan it again with a full hash\n", e.Path)
+			}
+			res.Unverifiable++
+			continue
+		}
+		if sample < 100 && rand.Float64()*100 >= sample {
+			continue
+		}
+
+		info, err := os.Stat(path)
+		if os.IsNotExist(err) {
+			res.Missing = append(res.Missing, e.Path)
+			continue
+		}
+		if err != nil {
+			log.Errorf("Error accessing file %s: %s\n", e.Path, err)
+			continue
+		}
+		if info.Size() != e.Size || info.ModTime().UnixNano() != e.Mtime {
+			log.Debugf("Changed since scan: %s\n", e.Path)
+			res.Changed++
+			continue
+		}
+
+		reporter.StartFile(path)
+		_, size, hash, err := file.Hash(path, 0, progressWriter)
+		if err != nil {
+			log.Errorf("Error hashing file %s: %s\n", e.Path, err)
+			continue
+		}
+		reporter.FileDone(size)
+
+		res.Verified++
+		res.Bytes += size
+		if hash != e.Hash {
+			log.Warnf("Corrupt: %s\n", e.Path)
+			res.Corrupt = append(res.Corrupt, e.Path)
+		}
+	}
+
+	return res
+}
+
+func printVerify(res verifyResult, format string) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(res)
+	case "text":
+		for _, path := range res.Corrupt {
+			fmt.Printf("Corrupt: %s\n", path)
+		}
+		for _, path := range res.Missing {
+			fmt.Printf("Missing: %s\n", path)
+		}
+		fmt.Printf("Verified %d files (%s), %d corrupt, %d missing, %d changed, %d unverifiable, %d offline\n", res.Verified,
+			progress.FormatBytes(res.Bytes), len(res.Corrupt), len(res.Missing), res.Changed, res.Unverifiable, res.Offline)
+		return nil
+	default:
+		return fmt.Errorf("unknown format: %s", format)
+	}
+}
+
+func verify(cmd *cobra.Command, args []string) error {
+	viper.AutomaticEnv()
+
+	viper.BindPFlag("db", cmd.Flags().Lookup("db"))
+	viper.BindPFlag("sample", cmd.Flags().Lookup("sample"))
+	viper.BindPFlag("rate", cmd.Flags().Lookup("rate"))
+	viper.BindPFlag("progress", cmd.Flags().Lookup("progress"))
+	viper.BindPFlag("format", cmd.Flags().Lookup("format"))
+
+	sample := viper.GetFloat64("sample")
+	if sample <= 0 || sample > 100 {
+		return fmt.Errorf("sample must be between 0 and 100: %g", sample)
+	}
+
+	log.Infof("Using database %s\n", viper.GetString("db"))
+
+	openStore()
+	defer store.Close()
+
+	root := rootArg(args)
+
+	entries, err := storedTree(root)
+	if err != nil {
+		return err
+	}
+
+	var progressWriter io.Writer
+	if viper.GetBool("progress") {
+		reporter = progress.New(os.Stderr)
+		reporter.Start()
+		progressWriter = reporter
+	}
+	if rate := viper.GetInt64("rate"); rate > 0 {
+		t := &throttle{rate: rate * 1048576}
+		if progressWriter != nil {
+			progressWriter = io.MultiWriter(progressWriter, t)
+		} else {
+			progressWriter = t
+		}
+	}
+
+	res := verifyEntries(entries, sample, progressWriter)
+	reporter.Finish()
+
+	if err := printVerify(res, viper.GetString("format")); err != nil {
+		return err
+	}
+
+	if len(res.Corrupt) > 0 {
+		return fmt.Errorf("found %s", plural(len(res.Corrupt), "corrupt file"))
+	}
+	return nil
+}
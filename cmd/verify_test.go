@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestVerifyEntries(t *testing.T) {
+	dir := scanTemp(t, map[string]string{
+		"ok":      "intact",
+		"corrupt": "bitrot",
+		"changed": "edited",
+		"missing": "deleted",
+	})
+
+	// Same size and modification time, only the content differs
+	corrupt := filepath.Join(dir, "corrupt")
+	info, err := os.Stat(corrupt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(corrupt, []byte("bitr0t"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(corrupt, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "changed"), []byte("edited again"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(dir, "missing")); err != nil {
+		t.Fatal(err)
+	}
+	// Never hashed by godupe
+	if err := store.Import(filepath.Join(dir, "imported"), "00", 5, "SHA256SUMS"); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := store.Tree(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := verifyEntries(entries, 100, nil)
+
+	want := verifyResult{
+		Corrupt:      []string{corrupt},
+		Missing:      []string{filepath.Join(dir, "missing")},
+		Verified:     2,
+		Bytes:        12,
+		Changed:      1,
+		Unverifiable: 1,
+	}
+	if !reflect.DeepEqual(res, want) {
+		t.Errorf("verifyEntries = %+v, want %+v", res, want)
+	}
+}
@@ -0,0 +1,150 @@
+/*
+Copyright © 2026 Riku Lindblad <riku.lindblad@iki.fi>
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/lepinkainen/godupe/file"
+	"github.com/lepinkainen/godupe/progress"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// volumeCmd groups the commands handling volumes
+var volumeCmd = &cobra.Command{
+	Use:   "volume",
+	Short: "Manage removable and network drives",
+	Long: `Files on volumes are stored relative to the volume root, e.g.
+1a2b-3c4d:/photos/img.jpg instead of /media/usb0/photos/img.jpg, so the
+same drive is recognised wherever it's mounted and different drives
+mounted at the same directory don't mix.
+
+Volumes are named by a ` + file.VolumeMarker + ` file in their root directory,
+or by the UUID of the file system. Use 'scan --volume' to scan a volume
+for the first time, after that its files are always stored on the volume.
+
+Files on volumes that aren't mounted stay in the DB and are reported as offline.`,
+}
+
+// volumeListCmd represents the volume list command
+var volumeListCmd = &cobra.Command{
+	Use:   "list",
+	Args:  cobra.NoArgs,
+	Short: "List volumes in the DB",
+	Run:   volumeList,
+}
+
+// volumeMarkCmd represents the volume mark command
+var volumeMarkCmd = &cobra.Command{
+	Use:   "mark [directory] [name]",
+	Args:  cobra.ExactArgs(2),
+	Short: "Make a directory the root of a named volume",
+	Run:   volumeMark,
+}
+
+func init() {
+	rootCmd.AddCommand(volumeCmd)
+	volumeCmd.AddCommand(volumeListCmd)
+	volumeCmd.AddCommand(volumeMarkCmd)
+
+	dbPath := defaultDBPath()
+
+	volumeListCmd.Flags().String("db", dbPath, "DB file to use")
+	volumeListCmd.Flags().String("format", "text", "Output format: text or json")
+}
+
+// volumeInfo is a volume in the volume list
+type volumeInfo struct {
+	Name   string `json:"name"`
+	Files  int    `json:"files"`
+	Bytes  int64  `json:"bytes"`
+	Online bool   `json:"online"`
+	// Last known root directory, empty for volumes merged from other DBs
+	Root string `json:"root,omitempty"`
+	Seen string `json:"seen,omitempty"`
+}
+
+func volumeList(cmd *cobra.Command, args []string) {
+	viper.AutomaticEnv()
+
+	viper.BindPFlag("db", cmd.Flags().Lookup("db"))
+	viper.BindPFlag("format", cmd.Flags().Lookup("format"))
+
+	log.Infof("Using database %s\n", viper.GetString("db"))
+
+	openStore()
+	defer store.Close()
+
+	usage, err := store.VolumeUsage()
+	if err != nil {
+		log.Fatal(err)
+	}
+	stored, err := store.Volumes()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	infos := map[string]*volumeInfo{}
+	for name, u := range usage {
+		infos[name] = &volumeInfo{Name: name, Files: u.Files, Bytes: u.Bytes}
+	}
+	for _, v := range stored {
+		info, ok := infos[v.Name]
+		if !ok {
+			info = &volumeInfo{Name: v.Name}
+			infos[v.Name] = info
+		}
+		info.Root = v.Root
+		info.Seen = v.Seen
+		_, info.Online = volumes.Mounted(v.Name)
+	}
+
+	list := []volumeInfo{}
+	for _, v := range infos {
+		list = append(list, *v)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+
+	switch viper.GetString("format") {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(list); err != nil {
+			log.Fatal(err)
+		}
+	case "text":
+		for _, v := range list {
+			status := "offline"
+			switch {
+			case v.Online:
+				status = "online at " + v.Root
+			case v.Root != "":
+				status = fmt.Sprintf("offline, last seen at %s on %s", v.Root, v.Seen)
+			}
+			fmt.Printf("%s: %d files, %s, %s\n", v.Name, v.Files, progress.FormatBytes(v.Bytes), status)
+		}
+	default:
+		log.Fatalf("unknown format: %s", viper.GetString("format"))
+	}
+}
+
+func volumeMark(cmd *cobra.Command, args []string) {
+	dir, err := filepath.Abs(args[0])
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = file.MarkVolume(dir, args[1])
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("Marked %s as volume %s, scan it with 'scan --volume'\n", dir, args[1])
+}
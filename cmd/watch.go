@@ -0,0 +1,483 @@
+/*
+Copyright © 2026 Riku Lindblad <riku.lindblad@iki.fi>
+*/
+package cmd
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/lepinkainen/godupe/file"
+	"github.com/lepinkainen/godupe/godupe"
+	"github.com/lepinkainen/godupe/metrics"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// watchCmd represents the watch command
+var watchCmd = &cobra.Command{
+	Use:   "watch [directory]...",
+	Args:  cobra.MinimumNArgs(1),
+	Short: "Keep the DB up to date with changes in the given directories",
+	Long: `Watch the given directories for changes and keep the DB up to date.
+
+New and modified files are hashed once they haven't changed for the
+settle time, deleted files are removed from the DB and renamed files
+are moved in the DB without hashing them again.
+
+If the system runs out of file watches, the directories are rescanned
+periodically instead.`,
+	Run: watch,
+}
+
+func init() {
+	rootCmd.AddCommand(watchCmd)
+
+	dbPath := defaultDBPath()
+
+	watchCmd.Flags().String("db", dbPath, "DB file to use")
+	watchCmd.Flags().BoolP("partial", "p", false, "Only read the first X MiB of a file to generate a partial hash")
+	watchCmd.Flags().Int64("limit", 2, "Amount of MiB to read when doing partial scan")
+	watchCmd.Flags().String("symlinks", "skip", "How to handle symbolic links: skip, follow or record")
+	watchCmd.Flags().Duration("settle", 5*time.Second, "Time a file must stay unchanged before it's hashed")
+	watchCmd.Flags().Duration("rescan-interval", time.Hour, "Time between full rescans when file watches are not available")
+	watchCmd.Flags().Bool("initial-scan", true, "Scan the directories before watching them")
+	watchCmd.Flags().String("metrics-listen", "", "Serve Prometheus metrics at /metrics on this address, e.g. :9101")
+}
+
+// A rename is reported as a rename of the old path followed by a create
+// of the new one, the create must arrive within this time
+const renameWindow = time.Second
+
+// errWatchLimit is returned when the system is out of file watches
+var errWatchLimit = errors.New("out of file watches")
+
+// pendingRename is a path that has been renamed, waiting for the new name
+type pendingRename struct {
+	path string
+	at   time.Time
+}
+
+// watcher keeps the DB up to date with changes in a set of directories
+type watcher struct {
+	fs      *fsnotify.Watcher
+	scanner *godupe.Scanner
+	dirs    []string
+	settle  time.Duration
+
+	// files waiting to settle before hashing, by time of last change
+	pending map[string]time.Time
+	renames []pendingRename
+}
+
+// addTree adds watches for a directory and all its subdirectories
+func (w *watcher) addTree(root string) error {
+	if w.fs == nil {
+		return nil
+	}
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			log.Errorf("Error accessing directory: %s\n", path)
+			return nil
+		}
+		if !d.IsDir() {
+			return nil
+		}
+
+		err = w.fs.Add(path)
+		if errors.Is(err, syscall.ENOSPC) || errors.Is(err, syscall.EMFILE) {
+			return errWatchLimit
+		}
+		if err != nil {
+			log.Errorf("Error watching %s: %s\n", path, err)
+		}
+		return nil
+	})
+}
+
+// removeTree removes the watches of a directory and its subdirectories
+func (w *watcher) removeTree(root string) {
+	if w.fs == nil {
+		return
+	}
+	for _, path := range w.fs.WatchList() {
+		if path == root || file.IsAncestor(root, path) {
+			w.fs.Remove(path)
+		}
+	}
+}
+
+// matchRename returns the old path of a file or directory that was renamed to the
+// file described by info
+func (w *watcher) matchRename(info fs.FileInfo) string {
+	for i, r := range w.renames {
+		if info.IsDir() {
+			// Other renames, like editors replacing files, aren't directories
+			if !w.knownDir(r.path) {
+				continue
+			}
+		} else {
+			entry, isFile, err := store.Lookup(volumes.DBPath(r.path))
+			if err != nil {
+				log.Fatal(err)
+			}
+			if !isFile || !sameFile(entry, info) {
+				continue
+			}
+		}
+		w.renames = append(w.renames[:i], w.renames[i+1:]...)
+		return r.path
+	}
+	return ""
+}
+
+// knownDir returns true if path was a watched directory or has files stored under it
+func (w *watcher) knownDir(path string) bool {
+	if w.fs != nil {
+		for _, watched := range w.fs.WatchList() {
+			if watched == path {
+				return true
+			}
+		}
+	}
+	entries, err := store.Tree(volumes.DBPath(path))
+	if err != nil {
+		log.Fatal(err)
+	}
+	return len(entries) > 0
+}
+
+// sameFile returns true if the stored entry is the file described by info,
+// a different file of the same size moved in at the same time must be hashed
+func sameFile(entry godupe.Entry, info fs.FileInfo) bool {
+	if entry.Size != info.Size() || entry.Mtime != info.ModTime().UnixNano() {
+		return false
+	}
+	device, inode, ok := file.Inode(info)
+	return ok && entry.Inode != 0 && entry.Device == device && entry.Inode == inode
+}
+
+// created handles a new file or directory
+func (w *watcher) created(path string) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return
+	}
+
+	if info.Mode()&fs.ModeSymlink != 0 {
+		w.scanner.ScanSymlink(path)
+		return
+	}
+
+	old := w.matchRename(info)
+
+	if info.IsDir() {
+		// The old watches point to the same directories, remove them before adding new ones
+		if old != "" {
+			w.removeTree(old)
+		}
+		if err := w.addTree(path); errors.Is(err, errWatchLimit) {
+			w.fallback(err)
+			return
+		}
+		if old != "" {
+			log.Infof("Moved: %s -> %s", old, path)
+			if err := store.MoveTree(volumes.DBPath(old), volumes.DBPath(path)); err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+		w.scanner.Scan(path)
+		return
+	}
+
+	if old != "" {
+		log.Infof("Moved: %s -> %s", old, path)
+		if err := store.Move(volumes.DBPath(old), volumes.DBPath(path)); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	w.pending[path] = time.Now()
+}
+
+// removed handles a deleted file or directory
+func (w *watcher) removed(path string) {
+	delete(w.pending, path)
+	log.Debugf("Removed: %s\n", path)
+	if err := store.Delete(volumes.DBPath(path)); err != nil {
+		log.Fatal(err)
+	}
+	if err := store.DeleteTree(volumes.DBPath(path)); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// flush hashes settled files and forgets renames without a new name
+func (w *watcher) flush() {
+	now := time.Now()
+
+	for path, changed := range w.pending {
+		if now.Sub(changed) < w.settle {
+			continue
+		}
+		delete(w.pending, path)
+
+		info, err := os.Lstat(path)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+
+		// Modified files need a new hash, and so do their hardlinks
+		links, err := forgetChanged(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Infof("Hashing: %s", path)
+		w.scanner.ScanFile(path, info)
+		for _, link := range links {
+			if linkInfo, err := os.Lstat(link); err == nil && os.SameFile(info, linkInfo) {
+				w.scanner.ScanFile(link, linkInfo)
+			}
+		}
+	}
+
+	// Moved outside the watched directories
+	for len(w.renames) > 0 && now.Sub(w.renames[0].at) > renameWindow {
+		w.removed(w.renames[0].path)
+		w.removeTree(w.renames[0].path)
+		w.renames = w.renames[1:]
+	}
+}
+
+// forgetChanged removes a modified file from the DB along with its hardlinks,
+// which would otherwise give it back their old hash. Returns the local paths
+// of the removed hardlinks.
+func forgetChanged(path string) ([]string, error) {
+	key := volumes.DBPath(path)
+	entry, ok, err := store.Lookup(key)
+	if err != nil {
+		return nil, err
+	}
+
+	var links []string
+	if ok && entry.Inode != 0 {
+		others, err := store.FindInode(entry.Device, entry.Inode, entry.Size)
+		if err != nil {
+			return nil, err
+		}
+		for _, other := range others {
+			local, ok := volumes.LocalPath(other.Path)
+			if other.Path == key || !ok {
+				continue
+			}
+			if err := store.Delete(other.Path); err != nil {
+				return nil, err
+			}
+			links = append(links, local)
+		}
+	}
+
+	return links, store.Delete(key)
+}
+
+// handle processes a single event
+func (w *watcher) handle(ev fsnotify.Event) {
+	// Renamed watched directories can report events without a name
+	if ev.Name == "" {
+		return
+	}
+
+	switch {
+	case ev.Has(fsnotify.Create):
+		w.created(ev.Name)
+	case ev.Has(fsnotify.Write):
+		w.pending[ev.Name] = time.Now()
+	case ev.Has(fsnotify.Remove):
+		w.removed(ev.Name)
+	case ev.Has(fsnotify.Rename):
+		delete(w.pending, ev.Name)
+		w.renames = append(w.renames, pendingRename{path: ev.Name, at: time.Now()})
+	}
+}
+
+// rescan walks all directories, adding new files, hashing changed ones again
+// and removing deleted ones
+func (w *watcher) rescan() {
+	for _, dir := range w.dirs {
+		log.Infof("Rescanning %s", dir)
+		pruneTree(dir)
+		w.scanner.Scan(dir)
+	}
+}
+
+// fallback stops watching and switches to periodic rescans
+func (w *watcher) fallback(err error) {
+	if w.fs == nil {
+		return
+	}
+	log.Warnf("Can't watch for changes (%s), rescanning every %s instead", err, viper.GetDuration("rescan-interval"))
+	w.fs.Close()
+	w.fs = nil
+}
+
+// run handles events until interrupted
+func (w *watcher) run() {
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	rescan := time.NewTicker(viper.GetDuration("rescan-interval"))
+	defer rescan.Stop()
+
+	for {
+		metrics.QueueDepth.Set(float64(len(w.pending)))
+
+		// Channels of a nil watcher block forever
+		var events chan fsnotify.Event
+		var errs chan error
+		if w.fs != nil {
+			events = w.fs.Events
+			errs = w.fs.Errors
+		}
+
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				return
+			}
+			w.handle(ev)
+		case err, ok := <-errs:
+			if !ok {
+				return
+			}
+			if errors.Is(err, fsnotify.ErrEventOverflow) {
+				log.Warn("Missed file system events, rescanning")
+				w.rescan()
+				continue
+			}
+			log.Errorf("Error watching files: %s\n", err)
+		case <-ticker.C:
+			w.flush()
+		case <-rescan.C:
+			if w.fs == nil {
+				w.rescan()
+			}
+		case <-interrupt:
+			log.Info("Stopping")
+			if w.fs != nil {
+				w.fs.Close()
+			}
+			return
+		}
+	}
+}
+
+// pruneTree removes files under root that don't exist any more from the DB,
+// and files whose size or modification time has changed so they're hashed again
+func pruneTree(root string) {
+	entries, err := store.Tree(volumes.DBPath(root))
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, e := range entries {
+		path, ok := volumes.LocalPath(e.Path)
+		if !ok {
+			continue
+		}
+		// Archive members go away with the archive
+		archive, _, member := file.SplitArchivePath(path)
+		if member {
+			path = archive
+		}
+		info, err := os.Lstat(path)
+		if os.IsNotExist(err) {
+			log.Debugf("Pruning %s\n", e.Path)
+			if err := store.Delete(e.Path); err != nil {
+				log.Fatal(err)
+			}
+			continue
+		}
+
+		// Members are hashed again with their archive, links don't have content of their own
+		if err != nil || member || e.Target != "" || !info.Mode().IsRegular() {
+			continue
+		}
+		// Rows stored before modification times were stored only have the size
+		if e.Size != info.Size() || e.Mtime != 0 && e.Mtime != info.ModTime().UnixNano() {
+			log.Debugf("Changed: %s\n", e.Path)
+			if err := store.Delete(e.Path); err != nil {
+				log.Fatal(err)
+			}
+			if err := store.DeleteTree(e.Path + "!"); err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+}
+
+func watch(cmd *cobra.Command, args []string) {
+	viper.AutomaticEnv()
+
+	viper.BindPFlag("db", cmd.Flags().Lookup("db"))
+	viper.BindPFlag("partial", cmd.Flags().Lookup("partial"))
+	viper.BindPFlag("limit", cmd.Flags().Lookup("limit"))
+	viper.BindPFlag("symlinks", cmd.Flags().Lookup("symlinks"))
+	viper.BindPFlag("settle", cmd.Flags().Lookup("settle"))
+	viper.BindPFlag("rescan-interval", cmd.Flags().Lookup("rescan-interval"))
+	viper.BindPFlag("initial-scan", cmd.Flags().Lookup("initial-scan"))
+	viper.BindPFlag("metrics-listen", cmd.Flags().Lookup("metrics-listen"))
+
+	log.Infof("Using database %s\n", viper.GetString("db"))
+
+	openStore()
+	defer store.Close()
+	serveMetrics()
+	for _, arg := range args {
+		if err := volumes.Register(arg, false); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	w := &watcher{scanner: newScanner(nil, ""), settle: viper.GetDuration("settle"), pending: map[string]time.Time{}}
+	for _, arg := range args {
+		dir, err := filepath.Abs(arg)
+		if err != nil {
+			log.Fatal(err)
+		}
+		w.dirs = append(w.dirs, dir)
+	}
+
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Warnf("Can't watch for changes (%s), rescanning every %s instead", err, viper.GetDuration("rescan-interval"))
+	} else {
+		w.fs = fsw
+		for _, dir := range w.dirs {
+			if err := w.addTree(dir); err != nil {
+				w.fallback(err)
+				break
+			}
+		}
+	}
+
+	if viper.GetBool("initial-scan") {
+		w.rescan()
+	}
+
+	if w.fs != nil {
+		log.Infof("Watching %d directories", len(w.fs.WatchList()))
+	}
+
+	w.run()
+}
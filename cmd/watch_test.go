@@ -0,0 +1,207 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lepinkainen/godupe/godupe"
+)
+
+// scanTemp scans a temporary directory into a new DB set as the global store
+func scanTemp(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s, err := godupe.OpenStore(godupe.StoreOptions{Path: filepath.Join(t.TempDir(), "test.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := godupe.LoadVolumes(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldStore, oldVolumes := store, volumes
+	store, volumes = s, v
+	t.Cleanup(func() {
+		s.Close()
+		store, volumes = oldStore, oldVolumes
+	})
+
+	scanner, err := godupe.NewScanner(godupe.ScannerOptions{Store: s, Volumes: v})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := scanner.Scan(dir); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestSameFile(t *testing.T) {
+	dir := scanTemp(t, map[string]string{"a": "same", "b": "same"})
+	a, b := filepath.Join(dir, "a"), filepath.Join(dir, "b")
+
+	entry, ok, err := store.Lookup(a)
+	if err != nil || !ok {
+		t.Fatalf("Lookup(%s) = %v, %v", a, ok, err)
+	}
+
+	info, err := os.Stat(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameFile(entry, info) {
+		t.Error("file isn't the same as its own entry")
+	}
+
+	// Same size and contents, different inode
+	info, err = os.Stat(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sameFile(entry, info) {
+		t.Error("a copy is the same file")
+	}
+}
+
+func TestMatchRename(t *testing.T) {
+	dir := scanTemp(t, map[string]string{"old": "contents", "other": "contents", "sub/file": "x"})
+
+	w := &watcher{}
+	for _, name := range []string{"other", "old", "sub"} {
+		w.renames = append(w.renames, pendingRename{path: filepath.Join(dir, name), at: time.Now()})
+	}
+
+	// old renamed to new, other is still pending
+	if err := os.Rename(filepath.Join(dir, "old"), filepath.Join(dir, "new")); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(filepath.Join(dir, "new"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := w.matchRename(info); got != filepath.Join(dir, "old") {
+		t.Errorf("matchRename of a renamed file = %q, want %s/old", got, dir)
+	}
+	if len(w.renames) != 2 {
+		t.Errorf("%d renames left, want 2", len(w.renames))
+	}
+
+	// Directories only match directories
+	if err := os.Rename(filepath.Join(dir, "sub"), filepath.Join(dir, "moved")); err != nil {
+		t.Fatal(err)
+	}
+	info, err = os.Stat(filepath.Join(dir, "moved"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := w.matchRename(info); got != filepath.Join(dir, "sub") {
+		t.Errorf("matchRename of a renamed directory = %q, want %s/sub", got, dir)
+	}
+
+	// A new file with the same contents isn't a rename
+	if err := os.WriteFile(filepath.Join(dir, "copy"), []byte("contents"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	info, err = os.Stat(filepath.Join(dir, "copy"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := w.matchRename(info); got != "" {
+		t.Errorf("matchRename of a new file = %q, want none", got)
+	}
+}
+
+func TestPruneTree(t *testing.T) {
+	dir := scanTemp(t, map[string]string{"kept": "kept", "deleted": "deleted", "changed": "changed"})
+
+	if err := os.Remove(filepath.Join(dir, "deleted")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "changed"), []byte("changed again"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	pruneTree(dir)
+
+	entries, err := store.Tree(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Path != filepath.Join(dir, "kept") {
+		t.Errorf("after pruning got %v, want only %s/kept", entries, dir)
+	}
+}
+
+// testWatcher returns a watcher hashing files without settling, it doesn't watch for events
+func testWatcher(t *testing.T) *watcher {
+	scanner, err := godupe.NewScanner(godupe.ScannerOptions{Store: store, Volumes: volumes})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &watcher{scanner: scanner, pending: map[string]time.Time{}}
+}
+
+func TestCreatedDirectory(t *testing.T) {
+	dir := scanTemp(t, map[string]string{"file": "x"})
+	w := testWatcher(t)
+
+	// An editor replacing a file isn't the directory being created
+	w.renames = append(w.renames, pendingRename{path: filepath.Join(dir, "file.swp"), at: time.Now()})
+	if err := os.MkdirAll(filepath.Join(dir, "new/sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "new/sub/file"), []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	w.created(filepath.Join(dir, "new"))
+
+	if _, ok, err := store.Lookup(filepath.Join(dir, "new/sub/file")); err != nil || !ok {
+		t.Errorf("file in a new directory wasn't hashed: %v, %v", ok, err)
+	}
+	if len(w.renames) != 1 {
+		t.Errorf("rename of an unknown path was matched to a new directory")
+	}
+}
+
+func TestFlushHardlink(t *testing.T) {
+	dir := scanTemp(t, map[string]string{"a": "old"})
+	a, b := filepath.Join(dir, "a"), filepath.Join(dir, "b")
+	if err := os.Link(a, b); err != nil {
+		t.Skip(err)
+	}
+	w := testWatcher(t)
+	if err := w.scanner.Scan(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	// Same size, so the link still looks like the same file
+	if err := os.WriteFile(a, []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	w.pending[a] = time.Time{}
+	w.flush()
+
+	want := fmt.Sprintf("%x", sha256.Sum256([]byte("new")))
+	for _, path := range []string{a, b} {
+		e, ok, err := store.Lookup(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok || e.Hash != want {
+			t.Errorf("%s has hash %q, want the hash of the new contents", path, e.Hash)
+		}
+	}
+}
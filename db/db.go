@@ -3,49 +3,157 @@ package db
 import (
 	"database/sql"
 	"fmt"
+	"strings"
 	"sync"
+	"unicode/utf8"
 
+	"github.com/lepinkainen/godupe/file"
+	"github.com/lepinkainen/godupe/metrics"
 	log "github.com/sirupsen/logrus"
-	"github.com/spf13/viper"
+
+	// We're using sqlite for the DB
+	_ "github.com/mattn/go-sqlite3"
 )
 
-// Init initializes the database
-func Init() {
-	db, err := sql.Open("sqlite3", viper.GetString("db"))
+// Store is a godupe DB
+type Store struct {
+	db   *sql.DB
+	path string
+}
+
+// Open opens the DB in the given file, creating it and updating the tables as needed
+func Open(path string) (*Store, error) {
+	db, err := sql.Open("sqlite3", path)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	s := &Store{db: db, path: path}
+	if err := s.init(); err != nil {
+		db.Close()
+		return nil, err
 	}
-	defer db.Close()
 
-	log.Debugf("Initializing DB in %s", viper.GetString("db"))
+	return s, nil
+}
 
-	// Create dupes table
-	sqlStmt := "CREATE TABLE IF NOT EXISTS dupes (path text not null primary key, hash text, partialhash text, date);"
+// Path returns the file the DB is stored in
+func (s *Store) Path() string {
+	return s.path
+}
 
-	_, err = db.Exec(sqlStmt)
-	if err != nil {
-		log.Errorf("%q: %s\n", err, sqlStmt)
+// Close closes the DB
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// init creates the tables and adds the columns missing from older DBs
+func (s *Store) init() error {
+	db := s.db
+
+	log.Debugf("Initializing DB in %s", s.path)
+
+	statements := []string{
+		"CREATE TABLE IF NOT EXISTS dupes (path text not null primary key, hash text, partialhash text, date);",
+		// we're doing a ton of operations on the path column, index it to aid performance a bit
+		"CREATE INDEX IF NOT EXISTS idx_path ON dupes (path);",
+	}
+	for _, sqlStmt := range statements {
+		if _, err := db.Exec(sqlStmt); err != nil {
+			return fmt.Errorf("%q: %s", err, sqlStmt)
+		}
+	}
+
+	// Older databases don't have these columns
+	columns := []struct{ name, columnType string }{
+		{"size", "integer"},
+		{"device", "integer"},
+		{"inode", "integer"},
+		{"linktarget", "text"},
+		{"mtime", "integer"},
+		{"source", "text"},
+		{"md5", "text"},
+	}
+	for _, c := range columns {
+		if err := addColumn(db, "dupes", c.name, c.columnType); err != nil {
+			return err
+		}
+	}
+
+	statements = []string{
+		// Perceptual hashes of images, stored as hex
+		"CREATE TABLE IF NOT EXISTS images (path text not null primary key, phash text, dhash text, date);",
+		// Last known roots of volumes, paths on volumes are stored relative to them
+		"CREATE TABLE IF NOT EXISTS volumes (name text not null primary key, root text, date);",
+		// Content defined chunks of files, for finding files sharing most of their content
+		"CREATE TABLE IF NOT EXISTS chunks (path text not null, offset integer not null, size integer, hash text, primary key (path, offset));",
+		"CREATE INDEX IF NOT EXISTS idx_chunks_hash ON chunks (hash);",
+	}
+	// Content lookups go through the hashes and size
+	for _, column := range []string{"hash", "partialhash", "size", "inode", "md5"} {
+		statements = append(statements, fmt.Sprintf("CREATE INDEX IF NOT EXISTS idx_%s ON dupes (%s);", column, column))
+	}
+	for _, sqlStmt := range statements {
+		if _, err := db.Exec(sqlStmt); err != nil {
+			return fmt.Errorf("%q: %s", err, sqlStmt)
+		}
 	}
 
-	// we're doing a ton of operations on the path column, index it to aid performance a bit
-	_, err = db.Exec("CREATE INDEX IF NOT EXISTS idx_path ON dupes (path);")
+	return nil
+}
+
+// tableColumns returns the names of the columns of a table, the table
+// doesn't exist if there are none
+func tableColumns(db *sql.DB, table string) (map[string]bool, error) {
+	rows, err := db.Query(fmt.Sprintf("pragma table_info(%s)", table))
 	if err != nil {
-		log.Errorf("%q: %s\n", err, sqlStmt)
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns := map[string]bool{}
+	for rows.Next() {
+		var cid, notnull, pk int
+		var name, ctype string
+		var dflt sql.NullString
+		err = rows.Scan(&cid, &name, &ctype, &notnull, &dflt, &pk)
+		if err != nil {
+			return nil, err
+		}
+		columns[name] = true
 	}
 
+	return columns, rows.Err()
 }
 
-// Prune deletes files that don't exist any more
-func Prune() {
-	db, err := sql.Open("sqlite3", viper.GetString("db"))
+// addColumn adds a column to an existing table if it's not there yet
+func addColumn(db *sql.DB, table, column, columnType string) error {
+	columns, err := tableColumns(db, table)
+	if err != nil || columns[column] {
+		return err
+	}
+
+	log.Debugf("Adding column %s to %s", column, table)
+
+	sqlStmt := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s;", table, column, columnType)
+	_, err = db.Exec(sqlStmt)
 	if err != nil {
-		log.Fatal(err)
+		return fmt.Errorf("%q: %s", err, sqlStmt)
 	}
-	defer db.Close()
+	return nil
+}
+
+// Prune deletes files that don't exist any more
+func (s *Store) Prune() error {
+	db := s.db
 
 	rows, err := db.Query("select path from dupes")
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 	defer rows.Close()
 
@@ -56,10 +164,14 @@ func Prune() {
 		var filename string
 		err = rows.Scan(&filename)
 		if err != nil {
-			log.Fatal(err)
+			return err
 		}
 		// File is in DB, but not in filesystem
-		if Exists(filename) != HashTypeNotExist {
+		res, err := s.Exists(filename)
+		if err != nil {
+			return err
+		}
+		if res != HashTypeNotExist {
 			fmt.Printf("Pruning %s\n", filename)
 			pruneList = append(pruneList, filename)
 		}
@@ -67,46 +179,41 @@ func Prune() {
 
 	err = rows.Err()
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
 	stmt, err := db.Prepare("delete from dupes where path = ?")
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 	defer stmt.Close()
 
 	for _, filename := range pruneList {
 		fmt.Printf("Pruned: %s\n", filename)
-		stmt.Exec(filename)
+		if _, err := stmt.Exec(filename); err != nil {
+			return err
+		}
 	}
+	return nil
 }
 
 // Dupe returns true if file has already been hashed
-func Dupe(hash, partialhash string) bool {
-	db, err := sql.Open("sqlite3", viper.GetString("db"))
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer db.Close()
+func (s *Store) Dupe(hash, partialhash string) (bool, error) {
+	db := s.db
 
 	stmt, err := db.Prepare("select count(*) from dupes where hash = ? or partialhash = ?")
 	if err != nil {
-		log.Fatal(err)
+		return false, err
 	}
 	defer stmt.Close()
 
 	var count int
 	err = stmt.QueryRow(hash, partialhash).Scan(&count)
 	if err != nil {
-		return false
-	}
-
-	if count > 0 {
-		return true
+		return false, err
 	}
 
-	return false
+	return count > 0, nil
 }
 
 // HashType stores the way the file has been hashed
@@ -125,15 +232,11 @@ const (
 
 // Check the files in batches
 // TODO: Dis no worky
-func ExistsAllBatch(filenames []string) bool {
+func (s *Store) ExistsAllBatch(filenames []string) (bool, error) {
 
 	const batchMax = 10
 
-	db, err := sql.Open("sqlite3", viper.GetString("db"))
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer db.Close()
+	db := s.db
 
 	for i := 0; i < len(filenames); i += batchMax {
 		// Limit the batch size to 10
@@ -145,7 +248,7 @@ func ExistsAllBatch(filenames []string) bool {
 
 		stmt, err := db.Prepare("select path from dupes where path IN " + inClause)
 		if err != nil {
-			log.Fatal(err)
+			return false, err
 		}
 		defer stmt.Close()
 
@@ -153,8 +256,7 @@ func ExistsAllBatch(filenames []string) bool {
 		rows, err := stmt.Query(batch)
 
 		if err != nil {
-			log.Errorf("error checking files: %v", err)
-			return false
+			return false, fmt.Errorf("error checking files: %w", err)
 		}
 		defer rows.Close()
 
@@ -165,11 +267,11 @@ func ExistsAllBatch(filenames []string) bool {
 		}
 
 		if count != batchSize {
-			return false
+			return false, nil
 		}
 	}
 
-	return true
+	return true, nil
 }
 
 // Helper function to build the IN clause string
@@ -193,60 +295,68 @@ func min(a, b int) int {
 	return b
 }
 
-func ExistsAll(filenames []string) bool {
-	db, err := sql.Open("sqlite3", viper.GetString("db"))
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer db.Close()
+// ExistsAll returns true if all files have been hashed. Partial hashes
+// are enough if partial is set, otherwise full hashes are needed.
+func (s *Store) ExistsAll(filenames []string, partial bool) (bool, error) {
+	db := s.db
 
-	stmt, err := db.Prepare("select path, hash, partialhash from dupes where path = ?")
+	stmt, err := db.Prepare("select coalesce(linktarget, ''), coalesce(hash, ''), coalesce(partialhash, '') from dupes where path = ?")
 	if err != nil {
-		log.Fatal(err)
+		return false, err
 	}
 	defer stmt.Close()
 
 	for _, filename := range filenames {
-		var path, hash, partialhash string
+		var linktarget, hash, partialhash string
 		row := stmt.QueryRow(filename)
-		err := row.Scan(&path, &hash, &partialhash)
+		err := row.Scan(&linktarget, &hash, &partialhash)
 		if err == sql.ErrNoRows {
 			// File not found in database
-			return false
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		// Recorded symlinks don't have a hash
+		if linktarget != "" {
+			continue
 		}
 		// In database, but no hash -> we need to calculate it
-		if hash == "" {
-			return false
+		if hash == "" && (!partial || partialhash == "") {
+			return false, nil
 		}
-		// Only check for existence, ignore hash types
 	}
 
 	// All files found
-	return true
+	return true, nil
 }
 
 // Exists returns true if file has already been hashed
-func Exists(filename string) HashType {
-	db, err := sql.Open("sqlite3", viper.GetString("db"))
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer db.Close()
+func (s *Store) Exists(filename string) (HashType, error) {
+	db := s.db
 
-	stmt, err := db.Prepare("select path, hash, partialhash from dupes where path = ?")
+	stmt, err := db.Prepare("select coalesce(hash, ''), coalesce(partialhash, '') from dupes where path = ?")
 	if err != nil {
-		log.Fatal(err)
+		return "", err
 	}
 	defer stmt.Close()
 
-	var path, hash, partialhash string
+	var hash, partialhash string
 	row := stmt.QueryRow(filename)
-	err = row.Scan(&path, &hash, &partialhash)
+	err = row.Scan(&hash, &partialhash)
 	if err == sql.ErrNoRows {
 		// No row returned, not hashed
-		return HashTypeNotExist
+		return HashTypeNotExist, nil
 	}
+	if err != nil {
+		return "", err
+	}
+
+	return hashType(hash, partialhash), nil
+}
 
+// hashType returns the way a file with the given hashes has been hashed
+func hashType(hash, partialhash string) HashType {
 	// Full hash, no need for partial
 	if hash != "" {
 		return HashTypeFull
@@ -259,10 +369,12 @@ func Exists(filename string) HashType {
 	return HashTypeNone
 }
 
-// Save stores the file and its metadata to the DB
-func Save(filename string, size int64, hash string) {
-	partial := viper.GetBool("partial")
-	partialSize := viper.GetInt64("limit") * 1048576
+// Save stores the file and its metadata to the DB. partialSize is the amount of
+// bytes read for partial hashes, 0 if the hash is a full hash.
+func (s *Store) Save(filename string, size int64, hash string, partialSize int64) error {
+	defer metrics.DBWrite("save").ObserveDuration()
+
+	partial := partialSize > 0
 
 	// TODO: In partial mode if size < partial limit, save partial hash also in full hash
 	// Maybe recurse the func and do two saves?
@@ -272,17 +384,15 @@ func Save(filename string, size int64, hash string) {
 	// make it doubleplusgood certain we're not writing in parallel
 	var mutex = &sync.Mutex{}
 	mutex.Lock()
+	defer mutex.Unlock()
 
-	db, err := sql.Open("sqlite3", viper.GetString("db"))
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer db.Close()
+	db := s.db
 
 	tx, err := db.Begin()
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
+	defer tx.Rollback()
 
 	var stmt *sql.Stmt
 
@@ -290,46 +400,840 @@ func Save(filename string, size int64, hash string) {
 	if partial {
 		// using partial hashing, file is smaller than partial limit, save to both full and partial hash (as they will be the same)
 		if size < partialSize {
-			stmt, err = tx.Prepare("insert into dupes(path, hash, partialhash, date) values(?, ?, ?, CURRENT_TIMESTAMP) on conflict(path) do update set partialhash=?, hash=?, date=CURRENT_TIMESTAMP")
+			stmt, err = tx.Prepare("insert into dupes(path, hash, partialhash, size, date) values(?, ?, ?, ?, CURRENT_TIMESTAMP) on conflict(path) do update set partialhash=?, hash=?, size=?, source=null, md5=null, date=CURRENT_TIMESTAMP")
 
 			if err != nil {
-				log.Fatal(err)
+				return err
 			}
 			defer stmt.Close()
-			_, err = stmt.Exec(filename, hash, hash, hash, hash)
+			_, err = stmt.Exec(filename, hash, hash, size, hash, hash, size)
 			if err != nil {
-				log.Fatal(err)
+				return err
 			}
 		} else {
 			// Partial, save to partialhash
-			stmt, err = tx.Prepare("insert into dupes(path, partialhash, date) values(?, ?, CURRENT_TIMESTAMP) on conflict(path) do update set partialhash=?")
+			stmt, err = tx.Prepare("insert into dupes(path, partialhash, size, date) values(?, ?, ?, CURRENT_TIMESTAMP) on conflict(path) do update set partialhash=?, size=?, source=null, md5=null, date=CURRENT_TIMESTAMP")
 			if err != nil {
-				log.Fatal(err)
+				return err
 			}
 			defer stmt.Close()
-			_, err = stmt.Exec(filename, hash, hash)
+			_, err = stmt.Exec(filename, hash, size, hash, size)
 			if err != nil {
-				log.Fatal(err)
+				return err
 			}
 		}
 	} else {
 		// full hash
-		stmt, err = tx.Prepare("insert into dupes(path, hash, date) values(?, ?, CURRENT_TIMESTAMP) on conflict(path) do update set hash=?")
+		stmt, err = tx.Prepare("insert into dupes(path, hash, size, date) values(?, ?, ?, CURRENT_TIMESTAMP) on conflict(path) do update set hash=?, size=?, source=null, md5=null, date=CURRENT_TIMESTAMP")
 		if err != nil {
-			log.Fatal(err)
+			return err
 		}
 		defer stmt.Close()
 		log.Debugf("Inserting: %s - %s\n", filename, hash)
-		_, err = stmt.Exec(filename, hash, hash)
+		_, err = stmt.Exec(filename, hash, size, hash, size)
+		if err != nil {
+			return err
+		}
+
+	}
+	return tx.Commit()
+}
+
+// Import stores a full hash read from a manifest without hashing the file.
+// A size of 0 means the size is unknown. The stat of a previous scan is
+// cleared, it doesn't belong to the imported hash.
+func (s *Store) Import(filename, hash string, size int64, source string) error {
+	defer metrics.DBWrite("import").ObserveDuration()
+
+	db := s.db
+
+	var sizeValue interface{}
+	if size > 0 {
+		sizeValue = size
+	}
+
+	_, err := db.Exec(`insert into dupes(path, hash, size, source, date) values(?, ?, ?, ?, CURRENT_TIMESTAMP)
+		on conflict(path) do update set hash=excluded.hash, size=excluded.size, source=excluded.source,
+		device=null, inode=null, mtime=null, md5=null, date=CURRENT_TIMESTAMP`,
+		filename, hash, sizeValue, source)
+	return err
+}
+
+// SaveBatch stores files hashed elsewhere in a single transaction.
+// The entries replace the stored hashes, sizes and modification times.
+func (s *Store) SaveBatch(entries []Entry) error {
+	defer metrics.DBWrite("save_batch").ObserveDuration()
+
+	db := s.db
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`insert into dupes(path, hash, partialhash, size, mtime, date) values(?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+		on conflict(path) do update set hash=excluded.hash, partialhash=excluded.partialhash, size=excluded.size,
+		mtime=excluded.mtime, device=null, inode=null, linktarget=null, source=null, md5=null, date=CURRENT_TIMESTAMP`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, e := range entries {
+		_, err = stmt.Exec(e.Path, nullString(e.Hash), nullString(e.PartialHash), e.Size, e.Mtime)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// nullString returns nil for empty strings so they're stored as NULL
+func nullString(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// Entry is a single file stored in the DB
+type Entry struct {
+	Path        string
+	Hash        string
+	PartialHash string
+	Size        int64
+	Device      uint64
+	Inode       uint64
+	// Target of a symbolic link, empty for regular files
+	Target string
+	// Modification time in nanoseconds since the epoch
+	Mtime int64
+	// Manifest the hash was imported from, empty for scanned files
+	Source string
+	// MD5 of the contents, told by an object store or computed while hashing, empty if not known
+	MD5 string
+}
+
+// HashType returns the way the file has been hashed
+func (e Entry) HashType() HashType {
+	return hashType(e.Hash, e.PartialHash)
+}
+
+// treeRange returns the bounds of a range query matching all paths under root,
+// an empty root matches the whole DB.
+// Range query instead of LIKE so the path index is used and
+// wildcard characters in paths don't need escaping.
+// '0' is the character after '/', so this matches everything under root/
+func treeRange(root string) (string, string) {
+	if root == "" {
+		return "", string(utf8.MaxRune)
+	}
+	root = strings.TrimSuffix(root, "/")
+	return root + "/", root + "0"
+}
+
+// Tree returns all files stored under the given directory,
+// an empty root returns the whole DB
+func (s *Store) Tree(root string) ([]Entry, error) {
+	db := s.db
+
+	from, to := treeRange(root)
+	rows, err := db.Query("select "+entryColumns+" from dupes where path > ? and path < ?", from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanEntries(rows)
+}
+
+// entryColumns are the columns read into an Entry by scanEntries
+const entryColumns = "path, coalesce(hash, ''), coalesce(partialhash, ''), coalesce(size, 0), coalesce(device, 0), coalesce(inode, 0), coalesce(linktarget, ''), coalesce(mtime, 0), coalesce(source, ''), coalesce(md5, '')"
+
+func scanEntries(rows *sql.Rows) ([]Entry, error) {
+	var entries []Entry
+	for rows.Next() {
+		var e Entry
+		err := rows.Scan(&e.Path, &e.Hash, &e.PartialHash, &e.Size, &e.Device, &e.Inode, &e.Target, &e.Mtime, &e.Source, &e.MD5)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+
+	return entries, rows.Err()
+}
+
+// SizeExists returns true if a file of the given size might be in the DB.
+// Rows saved before sizes were stored always match.
+func (s *Store) SizeExists(size int64) (bool, error) {
+	db := s.db
+
+	var exists bool
+	err := db.QueryRow("select exists(select 1 from dupes where size = ? or size is null)", size).Scan(&exists)
+	return exists, err
+}
+
+// FindByHash returns the paths of files with the given hash and size.
+// With partial set, the hash is matched against partial hashes as well.
+func (s *Store) FindByHash(hash string, size int64, partial bool) ([]string, error) {
+	db := s.db
+
+	hashColumn := "hash = ?"
+	args := []interface{}{hash}
+	if partial {
+		hashColumn = "(hash = ? or partialhash = ?)"
+		args = append(args, hash)
+	}
+	args = append(args, size)
+
+	rows, err := db.Query("select path from dupes where "+hashColumn+" and (size = ? or size is null)", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var paths []string
+	for rows.Next() {
+		var path string
+		err = rows.Scan(&path)
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, path)
+	}
+
+	return paths, rows.Err()
+}
+
+// Image is the perceptual hashes of a single image
+type Image struct {
+	Path  string
+	PHash string
+	DHash string
+}
+
+// ImageExists returns true if the image has already been hashed
+func (s *Store) ImageExists(filename string) (bool, error) {
+	db := s.db
+
+	var exists bool
+	err := db.QueryRow("select exists(select 1 from images where path = ?)", filename).Scan(&exists)
+	return exists, err
+}
+
+// SaveImage stores the perceptual hashes of an image
+func (s *Store) SaveImage(filename, phash, dhash string) error {
+	defer metrics.DBWrite("save_image").ObserveDuration()
+
+	db := s.db
+
+	_, err := db.Exec("insert into images(path, phash, dhash, date) values(?, ?, ?, CURRENT_TIMESTAMP) on conflict(path) do update set phash=?, dhash=?, date=CURRENT_TIMESTAMP",
+		filename, phash, dhash, phash, dhash)
+	return err
+}
+
+// Images returns the perceptual hashes of all images under the given directory,
+// an empty root returns the whole DB
+func (s *Store) Images(root string) ([]Image, error) {
+	db := s.db
+
+	from, to := treeRange(root)
+	rows, err := db.Query("select path, coalesce(phash, ''), coalesce(dhash, '') from images where path > ? and path < ?", from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var images []Image
+	for rows.Next() {
+		var img Image
+		err = rows.Scan(&img.Path, &img.PHash, &img.DHash)
 		if err != nil {
-			log.Fatal(err)
+			return nil, err
 		}
+		images = append(images, img)
+	}
+
+	return images, rows.Err()
+}
+
+// SetStat stores the device and inode numbers and modification time of a file
+func (s *Store) SetStat(filename string, device, inode uint64, mtime int64) error {
+	defer metrics.DBWrite("set_stat").ObserveDuration()
+
+	db := s.db
+
+	_, err := db.Exec("update dupes set device = ?, inode = ?, mtime = ? where path = ?", device, inode, mtime, filename)
+	return err
+}
+
+// FindInode returns the files stored with the given device, inode and size
+func (s *Store) FindInode(device, inode uint64, size int64) ([]Entry, error) {
+	db := s.db
+
+	rows, err := db.Query("select "+entryColumns+" from dupes where inode = ? and device = ? and size = ?", inode, device, size)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanEntries(rows)
+}
+
+// SetMD5 stores the MD5 of a file, told by an object store or computed while hashing
+func (s *Store) SetMD5(filename, md5 string) error {
+	defer metrics.DBWrite("set_md5").ObserveDuration()
+
+	db := s.db
+
+	_, err := db.Exec("update dupes set md5 = ? where path = ?", md5, filename)
+	return err
+}
 
+// FindMD5 returns the files with the given MD5 and size
+func (s *Store) FindMD5(md5 string, size int64) ([]Entry, error) {
+	db := s.db
+
+	rows, err := db.Query("select "+entryColumns+" from dupes where md5 = ? and size = ?", md5, size)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanEntries(rows)
+}
+
+// SaveLink stores a hardlink by copying the hashes of another path to the same file
+func (s *Store) SaveLink(filename, linked string, device, inode uint64, mtime int64) error {
+	defer metrics.DBWrite("save_link").ObserveDuration()
+
+	db := s.db
+
+	_, err := db.Exec(`insert into dupes(path, hash, partialhash, size, device, inode, mtime, md5, date)
+		select ?, hash, partialhash, size, ?, ?, ?, md5, CURRENT_TIMESTAMP from dupes where path = ?
+		on conflict(path) do update set hash=excluded.hash, partialhash=excluded.partialhash,
+		size=excluded.size, device=excluded.device, inode=excluded.inode, mtime=excluded.mtime,
+		md5=excluded.md5, date=CURRENT_TIMESTAMP`,
+		filename, device, inode, mtime, linked)
+	return err
+}
+
+// Duplicates returns all files under the given directory that have the same
+// full hash as another file there, ordered by hash. An empty root searches the whole DB.
+func (s *Store) Duplicates(root string) ([]Entry, error) {
+	db := s.db
+
+	from, to := treeRange(root)
+	rows, err := db.Query(`select `+entryColumns+` from dupes
+		where path > ? and path < ? and hash in (
+			select hash from dupes where path > ? and path < ? and hash != ''
+			group by hash having count(*) > 1)
+		order by hash, path`, from, to, from, to)
+	if err != nil {
+		return nil, err
 	}
+	defer rows.Close()
+
+	return scanEntries(rows)
+}
+
+// SaveSymlink stores a symbolic link without hashing its target
+func (s *Store) SaveSymlink(filename, target string) error {
+	defer metrics.DBWrite("save_symlink").ObserveDuration()
+
+	db := s.db
+
+	_, err := db.Exec(`insert into dupes(path, linktarget, date) values(?, ?, CURRENT_TIMESTAMP)
+		on conflict(path) do update set linktarget=excluded.linktarget, hash=null, partialhash=null,
+		size=null, device=null, inode=null, mtime=null, md5=null, date=CURRENT_TIMESTAMP`, filename, target)
+	return err
+}
+
+// SetLinkTarget marks a hashed file as a symbolic link to target
+func (s *Store) SetLinkTarget(filename, target string) error {
+	defer metrics.DBWrite("set_link_target").ObserveDuration()
+
+	db := s.db
+
+	_, err := db.Exec("update dupes set linktarget = ? where path = ?", target, filename)
+	return err
+}
+
+// tables holding rows keyed by file path
+var pathTables = []string{"dupes", "images", "chunks"}
+
+// Chunk is a content defined part of a file
+type Chunk struct {
+	Offset int64
+	Size   int
+	Hash   string
+}
+
+// SaveChunks replaces the stored chunks of a file
+func (s *Store) SaveChunks(filename string, chunks []Chunk) error {
+	defer metrics.DBWrite("save_chunks").ObserveDuration()
+
+	db := s.db
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("delete from chunks where path = ?", filename)
+	if err != nil {
+		return err
+	}
+
+	stmt, err := tx.Prepare("insert into chunks(path, offset, size, hash) values(?, ?, ?, ?)")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, c := range chunks {
+		_, err = stmt.Exec(filename, c.Offset, c.Size, c.Hash)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// ChunksExist returns true if the chunks of a file are stored
+func (s *Store) ChunksExist(filename string) (bool, error) {
+	db := s.db
+
+	var exists bool
+	err := db.QueryRow("select exists(select 1 from chunks where path = ?)", filename).Scan(&exists)
+	return exists, err
+}
+
+// Overlap is a pair of files sharing chunks
+type Overlap struct {
+	A, B string
+	// Bytes in chunks found in both files
+	Shared int64
+	// Total bytes of the files' distinct chunks
+	SizeA, SizeB int64
+}
+
+// Overlaps returns the pairs of files under root sharing chunks,
+// an empty root covers the whole DB
+func (s *Store) Overlaps(root string) ([]Overlap, error) {
+	db := s.db
+
+	from, to := treeRange(root)
+	// Chunks repeated within a file, like runs of zeroes, are only counted once
+	rows, err := db.Query(`with c as (select distinct path, hash, size from chunks where path > ? and path < ?),
+		totals as (select path, sum(size) as total from c group by path)
+		select a.path, b.path, sum(a.size), ta.total, tb.total
+		from c a join c b on a.hash = b.hash and a.path < b.path
+		join totals ta on ta.path = a.path
+		join totals tb on tb.path = b.path
+		group by a.path, b.path`, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var overlaps []Overlap
+	for rows.Next() {
+		var o Overlap
+		err = rows.Scan(&o.A, &o.B, &o.Shared, &o.SizeA, &o.SizeB)
+		if err != nil {
+			return nil, err
+		}
+		overlaps = append(overlaps, o)
+	}
+
+	return overlaps, rows.Err()
+}
+
+// ChunkUsage returns the total bytes of the chunked files under root and the
+// bytes left if every distinct chunk was stored only once
+func (s *Store) ChunkUsage(root string) (total, unique int64, err error) {
+	db := s.db
+
+	from, to := treeRange(root)
+	err = db.QueryRow(`select coalesce(sum(size), 0),
+		(select coalesce(sum(size), 0) from (select distinct hash, size from chunks where path > ? and path < ?))
+		from chunks where path > ? and path < ?`, from, to, from, to).Scan(&total, &unique)
+	return total, unique, err
+}
+
+// Lookup returns the stored entry for a path
+func (s *Store) Lookup(filename string) (Entry, bool, error) {
+	db := s.db
+
+	rows, err := db.Query("select "+entryColumns+" from dupes where path = ?", filename)
+	if err != nil {
+		return Entry{}, false, err
+	}
+	defer rows.Close()
+
+	entries, err := scanEntries(rows)
+	if err != nil || len(entries) == 0 {
+		return Entry{}, false, err
+	}
+	return entries[0], true, nil
+}
+
+// Delete removes a file from the DB
+func (s *Store) Delete(filename string) error {
+	defer metrics.DBWrite("delete").ObserveDuration()
+
+	db := s.db
+
+	for _, table := range pathTables {
+		_, err := db.Exec("delete from "+table+" where path = ?", filename)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteTree removes all files under the given directory from the DB
+func (s *Store) DeleteTree(root string) error {
+	defer metrics.DBWrite("delete_tree").ObserveDuration()
+
+	db := s.db
+
+	// An empty root would match everything
+	if root == "" {
+		return nil
+	}
+
+	from, to := treeRange(root)
+	for _, table := range pathTables {
+		_, err := db.Exec("delete from "+table+" where path > ? and path < ?", from, to)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Move changes the path of a file without touching its hashes
+func (s *Store) Move(from, to string) error {
+	defer metrics.DBWrite("move").ObserveDuration()
+
+	db := s.db
+
+	for _, table := range pathTables {
+		_, err := db.Exec("update or replace "+table+" set path = ? where path = ?", to, from)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MoveTree changes the paths of all files under a directory
+func (s *Store) MoveTree(from, to string) error {
+	defer metrics.DBWrite("move_tree").ObserveDuration()
+
+	db := s.db
+
+	// See treeRange for the range query, substr counts characters, not bytes
+	from = strings.TrimSuffix(from, "/")
+	to = strings.TrimSuffix(to, "/")
+	for _, table := range pathTables {
+		_, err := db.Exec("update or replace "+table+" set path = ? || substr(path, ?) where path > ? and path < ?",
+			to, utf8.RuneCountInString(from)+1, from+"/", from+"0")
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MergeResult counts the rows merged from another DB
+type MergeResult struct {
+	Added   int
+	Updated int
+	// Rows that were newer in this DB
+	Kept int
+}
+
+// tables merged row by row, chunks follow the dupes rows they belong to
+var mergeTables = []string{"dupes", "images"}
+
+// columns copied from other DBs in Merge, path is handled separately and date must be last
+var mergeColumns = map[string][]string{
+	"dupes":  {"hash", "partialhash", "size", "device", "inode", "linktarget", "mtime", "source", "md5", "date"},
+	"images": {"phash", "dhash", "date"},
+}
+
+// Merge copies the rows of another DB to this one. Local paths of the other DB
+// are stored on the given volume, paths already on a volume are kept as is.
+// When both DBs have the same path, the row with the newest date is kept.
+func (s *Store) Merge(other, volume string) (MergeResult, error) {
+	db := s.db
+
+	src, err := sql.Open("sqlite3", "file:"+other+"?mode=ro")
+	if err != nil {
+		return MergeResult{}, err
+	}
+	defer src.Close()
+
+	columns, err := tableColumns(src, "dupes")
+	if err != nil {
+		return MergeResult{}, err
+	}
+	if !columns["path"] {
+		return MergeResult{}, fmt.Errorf("%s is not a godupe database", other)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return MergeResult{}, err
+	}
+	defer tx.Rollback()
+
+	var res MergeResult
+	var files map[string]string
+	for _, table := range mergeTables {
+		merged, err := mergeTable(tx, src, table, volume, &res)
+		if err != nil {
+			return MergeResult{}, err
+		}
+		if table == "dupes" {
+			files = merged
+		}
+	}
+	if err := mergeChunks(tx, src, files); err != nil {
+		return MergeResult{}, err
+	}
+
 	err = tx.Commit()
 	if err != nil {
-		log.Fatal(err)
+		return MergeResult{}, err
+	}
+
+	return res, nil
+}
+
+// mergeTable copies the rows of a single table, columns missing from older DBs are left empty.
+// Returns the paths of the copied rows in the other DB mapped to the paths they're stored with.
+func mergeTable(tx *sql.Tx, src *sql.DB, table, volume string, res *MergeResult) (map[string]string, error) {
+	merged := map[string]string{}
+
+	srcColumns, err := tableColumns(src, table)
+	if err != nil || len(srcColumns) == 0 {
+		return merged, err
+	}
+
+	columns := mergeColumns[table]
+	selects := []string{"path"}
+	updates := []string{}
+	for _, column := range columns {
+		switch {
+		case !srcColumns[column]:
+			selects = append(selects, "null")
+		case column == "date":
+			// The driver would parse dates to time.Time, keep them in the format
+			// sqlite uses so dates written in other formats compare as strings
+			selects = append(selects, "datetime(date)")
+		default:
+			selects = append(selects, column)
+		}
+		updates = append(updates, column+"=excluded."+column)
+	}
+
+	rows, err := src.Query("select " + strings.Join(selects, ", ") + " from " + table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	insert, err := tx.Prepare(fmt.Sprintf("insert into %s(path, %s) values(?%s) on conflict(path) do update set %s",
+		table, strings.Join(columns, ", "), strings.Repeat(", ?", len(columns)), strings.Join(updates, ", ")))
+	if err != nil {
+		return nil, err
+	}
+	defer insert.Close()
+
+	values := make([]interface{}, len(selects))
+	pointers := make([]interface{}, len(selects))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+
+	for rows.Next() {
+		err = rows.Scan(pointers...)
+		if err != nil {
+			return nil, err
+		}
+
+		srcPath := fmt.Sprint(values[0])
+		path := toVolume(srcPath, volume)
+		values[0] = path
+		for i, column := range columns {
+			if column == "linktarget" && values[i+1] != nil {
+				values[i+1] = toVolume(fmt.Sprint(values[i+1]), volume)
+			}
+		}
+		date := values[len(values)-1]
+
+		var existing sql.NullString
+		err = tx.QueryRow("select datetime(date) from "+table+" where path = ?", path).Scan(&existing)
+		switch {
+		case err == sql.ErrNoRows:
+			res.Added++
+		case err != nil:
+			return nil, err
+		case date != nil && fmt.Sprintf("%s", date) > existing.String:
+			res.Updated++
+		default:
+			res.Kept++
+			continue
+		}
+
+		_, err = insert.Exec(values...)
+		if err != nil {
+			return nil, err
+		}
+		merged[srcPath] = path
+	}
+
+	return merged, rows.Err()
+}
+
+// mergeChunks replaces the chunks of the files copied from the other DB with
+// the chunks stored there, chunks of older content would no longer match the file
+func mergeChunks(tx *sql.Tx, src *sql.DB, files map[string]string) error {
+	columns, err := tableColumns(src, "chunks")
+	if err != nil {
+		return err
+	}
+	hasChunks := len(columns) > 0
+
+	for srcPath, path := range files {
+		_, err = tx.Exec("delete from chunks where path = ?", path)
+		if err != nil {
+			return err
+		}
+		if !hasChunks {
+			continue
+		}
+
+		rows, err := src.Query("select offset, size, hash from chunks where path = ?", srcPath)
+		if err != nil {
+			return err
+		}
+		var chunks []Chunk
+		for rows.Next() {
+			var c Chunk
+			err = rows.Scan(&c.Offset, &c.Size, &c.Hash)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			chunks = append(chunks, c)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return err
+		}
+
+		for _, c := range chunks {
+			_, err = tx.Exec("insert into chunks(path, offset, size, hash) values(?, ?, ?, ?)", path, c.Offset, c.Size, c.Hash)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// toVolume moves a local path to the given volume
+func toVolume(path, volume string) string {
+	if _, _, ok := file.SplitVolumePath(path); ok {
+		return path
+	}
+	return file.VolumePath(volume, path)
+}
+
+// Volume is a removable or network drive whose files are stored relative to its root
+type Volume struct {
+	Name string
+	// Directory the volume was last seen at
+	Root string
+	// Time the volume was last seen
+	Seen string
+}
+
+// SaveVolume stores the current root of a volume
+func (s *Store) SaveVolume(name, root string) error {
+	defer metrics.DBWrite("save_volume").ObserveDuration()
+
+	db := s.db
+
+	_, err := db.Exec(`insert into volumes(name, root, date) values(?, ?, CURRENT_TIMESTAMP)
+		on conflict(name) do update set root=excluded.root, date=CURRENT_TIMESTAMP`, name, root)
+	return err
+}
+
+// Volumes returns all volumes that have been scanned on this machine
+func (s *Store) Volumes() ([]Volume, error) {
+	db := s.db
+
+	rows, err := db.Query("select name, coalesce(root, ''), coalesce(cast(date as text), '') from volumes order by name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var volumes []Volume
+	for rows.Next() {
+		var v Volume
+		err = rows.Scan(&v.Name, &v.Root, &v.Seen)
+		if err != nil {
+			return nil, err
+		}
+		volumes = append(volumes, v)
+	}
+
+	return volumes, rows.Err()
+}
+
+// Usage is the amount of files stored on a volume
+type Usage struct {
+	Files int
+	Bytes int64
+}
+
+// VolumeUsage returns the amount of files stored on each volume,
+// including volumes merged from other DBs
+func (s *Store) VolumeUsage() (map[string]Usage, error) {
+	db := s.db
+
+	// See file.SplitVolumePath, names are at least two characters
+	rows, err := db.Query(`select substr(path, 1, instr(path, ':/') - 1) as volume, count(*), coalesce(sum(size), 0)
+		from dupes where path not like '/%' and instr(path, ':/') > 2 group by volume`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	usage := map[string]Usage{}
+	for rows.Next() {
+		var name string
+		var u Usage
+		err = rows.Scan(&name, &u.Files, &u.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		usage[name] = u
 	}
 
-	mutex.Unlock()
+	return usage, rows.Err()
 }
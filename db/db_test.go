@@ -0,0 +1,301 @@
+package db
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// openTest opens an empty store in a temporary directory
+func openTest(t *testing.T, name string) *Store {
+	s, err := Open(filepath.Join(t.TempDir(), name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// paths returns the sorted paths of entries
+func paths(entries []Entry) []string {
+	var p []string
+	for _, e := range entries {
+		p = append(p, e.Path)
+	}
+	sort.Strings(p)
+	return p
+}
+
+func TestExists(t *testing.T) {
+	s := openTest(t, "test.db")
+
+	if err := s.Save("/a/full", 100, "f", 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Save("/a/partial", 100, "p", 10); err != nil {
+		t.Fatal(err)
+	}
+	// Smaller than the partial size, the partial hash is the full hash
+	if err := s.Save("/a/small", 5, "s", 10); err != nil {
+		t.Fatal(err)
+	}
+
+	for path, want := range map[string]HashType{
+		"/a/full":    HashTypeFull,
+		"/a/partial": HashTypePartial,
+		"/a/small":   HashTypeFull,
+		"/a/missing": HashTypeNotExist,
+	} {
+		got, err := s.Exists(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("Exists(%s) = %s, want %s", path, got, want)
+		}
+	}
+
+	tests := []struct {
+		files   []string
+		partial bool
+		want    bool
+	}{
+		{[]string{"/a/full", "/a/small"}, false, true},
+		{[]string{"/a/full", "/a/partial"}, false, false},
+		{[]string{"/a/full", "/a/partial"}, true, true},
+		{[]string{"/a/full", "/a/missing"}, true, false},
+	}
+	for _, tt := range tests {
+		got, err := s.ExistsAll(tt.files, tt.partial)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("ExistsAll(%v, %v) = %v, want %v", tt.files, tt.partial, got, tt.want)
+		}
+	}
+}
+
+func TestTree(t *testing.T) {
+	s := openTest(t, "test.db")
+
+	for _, p := range []string{"/a/b/1", "/a/b/c/2", "/a/bc/3", "/a/b0", "/a/4"} {
+		if err := s.Save(p, 1, "h", 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, err := s.Tree("/a/b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := paths(entries), []string{"/a/b/1", "/a/b/c/2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Tree(/a/b) = %v, want %v", got, want)
+	}
+
+	entries, err = s.Tree("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 5 {
+		t.Errorf("Tree of the whole DB has %d files, want 5", len(entries))
+	}
+}
+
+func TestMove(t *testing.T) {
+	s := openTest(t, "test.db")
+
+	for _, p := range []string{"/a/1", "/a/sub/2", "/ab/3"} {
+		if err := s.Save(p, 1, "h"+p, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.SaveChunks("/a/1", []Chunk{{0, 1, "c"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.MoveTree("/a", "/b"); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := s.Tree("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := paths(entries), []string{"/ab/3", "/b/1", "/b/sub/2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after MoveTree got %v, want %v", got, want)
+	}
+	if ok, err := s.ChunksExist("/b/1"); err != nil || !ok {
+		t.Errorf("chunks didn't move with the file: %v, %v", ok, err)
+	}
+
+	if err := s.Move("/b/1", "/c"); err != nil {
+		t.Fatal(err)
+	}
+	e, ok, err := s.Lookup("/c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok || e.Hash != "h/a/1" {
+		t.Errorf("Lookup(/c) = %+v, %v, want the hash of /a/1", e, ok)
+	}
+	if _, ok, _ := s.Lookup("/b/1"); ok {
+		t.Error("moved file still stored with its old path")
+	}
+}
+
+func TestMerge(t *testing.T) {
+	s := openTest(t, "test.db")
+	other := openTest(t, "other.db")
+
+	// Only in the other DB, with chunks
+	other.Save("/photos/new", 10, "new", 0)
+	other.SaveChunks("/photos/new", []Chunk{{0, 4, "c1"}, {4, 6, "c2"}})
+	// Already on a volume, kept as is
+	other.Save("usb:/x", 10, "x", 0)
+	// In both, newer in the other DB
+	s.Save("nas:/photos/updated", 10, "old", 0)
+	other.Save("/photos/updated", 10, "updated", 0)
+	// In both, newer in this DB
+	s.Save("nas:/photos/kept", 10, "kept", 0)
+	other.Save("/photos/kept", 10, "stale", 0)
+
+	s.db.Exec("update dupes set date = '2020-01-01 00:00:00' where path = 'nas:/photos/updated'")
+	other.db.Exec("update dupes set date = '2020-01-01 00:00:00' where path = '/photos/kept'")
+
+	res, err := s.Merge(other.Path(), "nas")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (MergeResult{Added: 2, Updated: 1, Kept: 1}); res != want {
+		t.Errorf("Merge = %+v, want %+v", res, want)
+	}
+
+	for path, want := range map[string]string{
+		"nas:/photos/new":     "new",
+		"usb:/x":              "x",
+		"nas:/photos/updated": "updated",
+		"nas:/photos/kept":    "kept",
+	} {
+		e, ok, err := s.Lookup(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok || e.Hash != want {
+			t.Errorf("%s has hash %q, want %q", path, e.Hash, want)
+		}
+	}
+
+	total, _, err := s.ChunkUsage("nas:/photos")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 10 {
+		t.Errorf("merged chunks cover %d bytes, want 10", total)
+	}
+}
+
+func TestMergeNotGodupe(t *testing.T) {
+	s := openTest(t, "test.db")
+
+	other := filepath.Join(t.TempDir(), "other.db")
+	o, err := Open(other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o.db.Exec("drop table dupes")
+	o.Close()
+
+	if _, err := s.Merge(other, "nas"); err == nil {
+		t.Error("merged a DB without a dupes table")
+	}
+}
+
+func TestMergeDates(t *testing.T) {
+	s := openTest(t, "test.db")
+	other := openTest(t, "other.db")
+
+	// Hashed first here, then in the other DB, then again here after the file changed
+	for _, partialSize := range []int64{0, 10} {
+		path := fmt.Sprintf("/rehashed%d", partialSize)
+		s.Save("nas:"+path, 100, "old", partialSize)
+		s.db.Exec("update dupes set date = '2020-01-01 00:00:00' where path = ?", "nas:"+path)
+		other.Save(path, 100, "other", partialSize)
+		other.db.Exec("update dupes set date = '2021-01-01 00:00:00' where path = ?", path)
+		s.Save("nas:"+path, 100, "new", partialSize)
+	}
+
+	// The same time in other formats, only the hour differs
+	s.Save("nas:/formats", 10, "local", 0)
+	s.db.Exec("update dupes set date = '2022-06-01T12:00:00' where path = 'nas:/formats'")
+	other.Save("/formats", 10, "newer", 0)
+	other.db.Exec("update dupes set date = '2022-06-01 15:00:00+02:00' where path = '/formats'")
+
+	res, err := s.Merge(other.Path(), "nas")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (MergeResult{Updated: 1, Kept: 2}); res != want {
+		t.Errorf("Merge = %+v, want %+v", res, want)
+	}
+
+	for path, want := range map[string]string{
+		"nas:/rehashed0":  "new",
+		"nas:/rehashed10": "new",
+		"nas:/formats":    "newer",
+	} {
+		e, _, err := s.Lookup(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := e.Hash + e.PartialHash; got != want {
+			t.Errorf("%s has hash %q after merging, want %q", path, got, want)
+		}
+	}
+}
+
+func TestRehashClearsMD5(t *testing.T) {
+	s := openTest(t, "test.db")
+
+	tests := []struct {
+		name string
+		size int64
+		save func(path string) error
+	}{
+		{"full", 100, func(path string) error { return s.Save(path, 100, "new", 0) }},
+		{"partial", 100, func(path string) error { return s.Save(path, 100, "new", 10) }},
+		{"small", 5, func(path string) error { return s.Save(path, 5, "new", 10) }},
+		{"import", 100, func(path string) error { return s.Import(path, "new", 100, "SHA256SUMS") }},
+		{"batch", 100, func(path string) error { return s.SaveBatch([]Entry{{Path: path, Hash: "new", Size: 100}}) }},
+		{"link", 100, func(path string) error {
+			if err := s.Save("/linked", 100, "new", 0); err != nil {
+				return err
+			}
+			return s.SaveLink(path, "/linked", 1, 2, 3)
+		}},
+	}
+
+	for i, tt := range tests {
+		path := "/" + tt.name
+		md5 := fmt.Sprintf("%032x", i+1)
+		if err := s.Save(path, tt.size, "old", 0); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.SetMD5(path, md5); err != nil {
+			t.Fatal(err)
+		}
+		if err := tt.save(path); err != nil {
+			t.Fatal(err)
+		}
+
+		// The MD5 belonged to the old content
+		found, err := s.FindMD5(md5, tt.size)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(found) != 0 {
+			t.Errorf("%s: FindMD5 = %v after rehashing", tt.name, paths(found))
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package file
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/bzip2"
+	"compress/gzip"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+)
+
+// ArchiveSeparator separates the archive path from the member path
+// in virtual paths, e.g. /backup/photos.zip!/2019/img.jpg
+const ArchiveSeparator = "!/"
+
+// archive formats by file name suffix
+var archiveTypes = []struct {
+	suffix string
+	format string
+}{
+	{".zip", "zip"},
+	{".tar", "tar"},
+	{".tar.gz", "tar.gz"},
+	{".tgz", "tar.gz"},
+	{".tar.bz2", "tar.bz2"},
+	{".tbz2", "tar.bz2"},
+}
+
+// ArchiveMemberFunc is called for every regular file in an archive
+// with the path inside the archive, size and contents of the member
+type ArchiveMemberFunc func(member string, size int64, r io.Reader) error
+
+func archiveFormat(filename string) string {
+	lower := strings.ToLower(filename)
+	for _, t := range archiveTypes {
+		if strings.HasSuffix(lower, t.suffix) {
+			return t.format
+		}
+	}
+	return ""
+}
+
+// IsArchive returns true if the file is a supported archive based on its name
+func IsArchive(filename string) bool {
+	return archiveFormat(filename) != ""
+}
+
+// ArchivePath returns the virtual path of a member inside an archive
+func ArchivePath(archive, member string) string {
+	return archive + ArchiveSeparator + strings.TrimPrefix(path.Clean("/"+member), "/")
+}
+
+// SplitArchivePath splits a virtual path into the archive and member paths.
+// ok is false for regular paths.
+func SplitArchivePath(virtualPath string) (archive, member string, ok bool) {
+	i := strings.Index(virtualPath, ArchiveSeparator)
+	if i < 0 {
+		return virtualPath, "", false
+	}
+	return virtualPath[:i], virtualPath[i+len(ArchiveSeparator):], true
+}
+
+// WalkArchive calls fn for every regular file in the archive name in fsys.
+// Archives inside archives are not opened.
+func WalkArchive(fsys fs.FS, name string, fn ArchiveMemberFunc) error {
+	format := archiveFormat(name)
+	if format == "" {
+		return nil
+	}
+
+	f, err := fsys.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if format == "zip" {
+		return walkZip(f, fn)
+	}
+	return walkTar(f, format, fn)
+}
+
+func walkZip(f fs.File, fn ArchiveMemberFunc) error {
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	// Zip needs random access, copy the archive to a temporary file if the
+	// file system can't seek. Archives can be too large to read to memory.
+	ra, ok := f.(io.ReaderAt)
+	if !ok {
+		tmp, err := os.CreateTemp("", "godupe-*.zip")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(tmp.Name())
+		defer tmp.Close()
+
+		if _, err := io.Copy(tmp, f); err != nil {
+			return err
+		}
+		ra = tmp
+	}
+
+	zr, err := zip.NewReader(ra, info.Size())
+	if err != nil {
+		return err
+	}
+
+	for _, f := range zr.File {
+		if !f.Mode().IsRegular() {
+			continue
+		}
+
+		r, err := f.Open()
+		if err != nil {
+			return err
+		}
+		err = fn(f.Name, int64(f.UncompressedSize64), r)
+		r.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func walkTar(f fs.File, format string, fn ArchiveMemberFunc) error {
+	var r io.Reader = f
+	switch format {
+	case "tar.gz":
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	case "tar.bz2":
+		r = bzip2.NewReader(f)
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		err = fn(hdr.Name, hdr.Size, tr)
+		if err != nil {
+			return err
+		}
+	}
+}
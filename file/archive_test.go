@@ -0,0 +1,157 @@
+package file
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/fs"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestArchivePath(t *testing.T) {
+	tests := []struct {
+		archive, member, want string
+	}{
+		{"/backup/photos.zip", "2019/img.jpg", "/backup/photos.zip!/2019/img.jpg"},
+		{"/backup/photos.zip", "/2019/../img.jpg", "/backup/photos.zip!/img.jpg"},
+		{"nas:/a.tar", "./b", "nas:/a.tar!/b"},
+	}
+	for _, tt := range tests {
+		got := ArchivePath(tt.archive, tt.member)
+		if got != tt.want {
+			t.Errorf("ArchivePath(%q, %q) = %q, want %q", tt.archive, tt.member, got, tt.want)
+		}
+		archive, _, ok := SplitArchivePath(got)
+		if !ok || archive != tt.archive {
+			t.Errorf("SplitArchivePath(%q) = %q, %v, want %q", got, archive, ok, tt.archive)
+		}
+	}
+
+	if _, _, ok := SplitArchivePath("/backup/photos.zip"); ok {
+		t.Error("SplitArchivePath of a regular path returned ok")
+	}
+}
+
+// members are the files put in the test archives
+var members = map[string]string{
+	"a.txt":     "hello",
+	"dir/b.txt": "world",
+}
+
+func zipArchive(t *testing.T) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, name := range []string{"a.txt", "dir/b.txt"} {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(w, members[name])
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func tarGzArchive(t *testing.T) []byte {
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	tw.WriteHeader(&tar.Header{Name: "dir/", Typeflag: tar.TypeDir, Mode: 0755})
+	for _, name := range []string{"a.txt", "dir/b.txt"} {
+		tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(members[name]))})
+		io.WriteString(tw, members[name])
+	}
+	tw.WriteHeader(&tar.Header{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "a.txt"})
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	gw.Close()
+	return buf.Bytes()
+}
+
+func TestWalkArchive(t *testing.T) {
+	fsys := fstest.MapFS{
+		"files.zip":    {Data: zipArchive(t)},
+		"files.tar.gz": {Data: tarGzArchive(t)},
+		"plain.txt":    {Data: []byte("not an archive")},
+	}
+
+	for _, name := range []string{"files.zip", "files.tar.gz"} {
+		got := map[string]string{}
+		err := WalkArchive(fsys, name, func(member string, size int64, r io.Reader) error {
+			data, err := io.ReadAll(r)
+			if err != nil {
+				return err
+			}
+			if int64(len(data)) != size {
+				t.Errorf("%s: %s is %d bytes, size says %d", name, member, len(data), size)
+			}
+			got[member] = string(data)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		// Directories and links aren't members
+		if !reflect.DeepEqual(got, members) {
+			t.Errorf("%s: got members %v, want %v", name, got, members)
+		}
+	}
+
+	called := false
+	err := WalkArchive(fsys, "plain.txt", func(string, int64, io.Reader) error {
+		called = true
+		return nil
+	})
+	if err != nil || called {
+		t.Errorf("WalkArchive of a regular file = %v, called %v", err, called)
+	}
+}
+
+// streamFS hides io.ReaderAt of the files, like file systems that can only stream
+type streamFS struct {
+	fs.FS
+}
+
+func (f streamFS) Open(name string) (fs.File, error) {
+	file, err := f.FS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return struct{ fs.File }{file}, nil
+}
+
+func TestWalkZipStream(t *testing.T) {
+	fsys := streamFS{fstest.MapFS{"files.zip": {Data: zipArchive(t)}}}
+	if _, ok := interface{}(mustOpen(t, fsys, "files.zip")).(io.ReaderAt); ok {
+		t.Fatal("stream file system can seek")
+	}
+
+	got := map[string]string{}
+	err := WalkArchive(fsys, "files.zip", func(member string, size int64, r io.Reader) error {
+		data, err := io.ReadAll(r)
+		got[member] = string(data)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, members) {
+		t.Errorf("got members %v, want %v", got, members)
+	}
+}
+
+func mustOpen(t *testing.T, fsys fs.FS, name string) fs.File {
+	f, err := fsys.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Close() })
+	return f
+}
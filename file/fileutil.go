@@ -2,42 +2,42 @@ package file
 
 import (
 	"crypto/sha256"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
+	"path"
+	"strings"
 
 	log "github.com/sirupsen/logrus"
 
 	"os"
 	"path/filepath"
-
-	"github.com/schollz/progressbar/v3"
-	"github.com/spf13/viper"
 )
 
-// Helper function to list files in a directory and get their absolute paths
-func WalkDirFiles(dirPath string) ([]string, error) {
+// Helper function to list files in a directory of fsys and get their paths
+// Symlinks are included only if symlinks is set
+func WalkDirFiles(fsys fs.FS, dir string, symlinks bool) ([]string, error) {
 	files := []string{}
-	entries, err := os.ReadDir(dirPath)
+	entries, err := fs.ReadDir(fsys, dir)
 	if err != nil {
 		return nil, err
 	}
 	for _, entry := range entries {
-		if !entry.IsDir() {
-			absPath, err := filepath.Abs(filepath.Join(dirPath, entry.Name()))
-			if err != nil {
-				return nil, err
-			}
-			files = append(files, absPath)
+		if entry.Name() == VolumeMarker {
+			continue
+		}
+		if entry.Type().IsRegular() || (symlinks && entry.Type()&fs.ModeSymlink != 0) {
+			files = append(files, path.Join(dir, entry.Name()))
 		}
 	}
 	return files, nil
 }
 
 // Hash a file, return its absolute path, size and SHA256
-func Hash(filename string) (string, int64, string, error) {
-	partial := viper.GetBool("partial")
-	partialSize := viper.GetInt64("limit") * 1048576
-
+// Only the first partialSize bytes are read, unless it's 0.
+// Bytes read are also written to progress, if given
+func Hash(filename string, partialSize int64, progress io.Writer) (string, int64, string, error) {
 	absfile, _ := filepath.Abs(filename)
 
 	f, err := os.Open(absfile)
@@ -60,38 +60,69 @@ func Hash(filename string) (string, int64, string, error) {
 		}
 	*/
 
+	hash, err := HashReader(f, info.Size(), partialSize, progress)
+	if err != nil {
+		return "", 0, "", err
+	}
+
+	return absfile, info.Size(), hash, nil
+}
+
+// HashFS hashes a file in fsys, returning its size and SHA256.
+// Only the first partialSize bytes are read, unless it's 0.
+// Bytes read are also written to progress, if given
+func HashFS(fsys fs.FS, name string, partialSize int64, progress io.Writer) (int64, string, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return 0, "", err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return 0, "", err
+	}
+
+	hash, err := HashReader(f, info.Size(), partialSize, progress)
+	if err != nil {
+		return 0, "", err
+	}
+
+	return info.Size(), hash, nil
+}
+
+// HashReader returns the SHA256 of the contents of r, which is size bytes long.
+// Only the first partialSize bytes are read, unless it's 0.
+func HashReader(r io.Reader, size int64, partialSize int64, progress io.Writer) (string, error) {
+	partial := partialSize > 0
+
 	var hashSize int64
 	// If file is smaller than partial size, don't try to read more than the file's size
-	if info.Size() < partialSize {
-		hashSize = info.Size()
+	if size < partialSize {
+		hashSize = size
 	} else {
 		hashSize = partialSize
 	}
 
-	// Only use progress bar for files over this size
-	//var useBar = info.Size() > (1 * 1000 * 1000)
-	//useBar := true
-
-	// Create progress bar reader
-	bar := progressbar.DefaultBytes(info.Size())
-	bar.Describe(filename)
-
 	h := sha256.New()
 
+	var w io.Writer = h
+	if progress != nil {
+		w = io.MultiWriter(h, progress)
+	}
+
 	// Only do a partial hash
 	if partial {
-		if _, err := io.CopyN(io.MultiWriter(h, bar), f, hashSize); err != nil {
-			log.Fatal(err)
+		if _, err := io.CopyN(w, r, hashSize); err != nil {
+			return "", err
 		}
 	} else {
-		if _, err := io.Copy(io.MultiWriter(h, bar), f); err != nil {
-			log.Fatal(err)
+		if _, err := io.Copy(w, r); err != nil {
+			return "", err
 		}
 	}
 
-	bar.Finish()
-
-	return absfile, info.Size(), fmt.Sprintf("%x", h.Sum(nil)), nil
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
 }
 
 // Exists returns true if the given file exists
@@ -102,21 +133,25 @@ func Exists(filename string) bool {
 	return true
 }
 
-// Helper function to check for subdirectories
-func HasSubdirectories(dir string) (bool, error) {
-	f, err := os.Open(dir)
-	if err != nil {
-		return false, err
-	}
-	defer f.Close()
-
-	names, err := f.Readdirnames(0) // Get a list of directory entries
+// Helper function to check for subdirectories of a directory in fsys
+func HasSubdirectories(fsys fs.FS, dir string) (bool, error) {
+	entries, err := fs.ReadDir(fsys, dir)
 	if err != nil {
 		return false, err
 	}
 
-	for _, name := range names {
-		finfo, err := os.Stat(filepath.Join(dir, name))
+	for _, entry := range entries {
+		if entry.IsDir() {
+			return true, nil // Found a subdirectory
+		}
+		if entry.Type()&fs.ModeSymlink == 0 {
+			continue
+		}
+		finfo, err := fs.Stat(fsys, path.Join(dir, entry.Name()))
+		// Broken symlinks point nowhere
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
 		if err != nil {
 			return false, err
 		}
@@ -127,3 +162,74 @@ func HasSubdirectories(dir string) (bool, error) {
 
 	return false, nil // No subdirectories found
 }
+
+// Copy copies src to dst, creating parent directories as needed.
+// The file is written under a temporary name and renamed when complete,
+// modification time is preserved.
+func Copy(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(dst), os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	out, err := os.CreateTemp(filepath.Dir(dst), ".godupe-*")
+	if err != nil {
+		return err
+	}
+	// Clean up the temporary file on failure, a no-op after a successful rename
+	defer os.Remove(out.Name())
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Chmod(out.Name(), info.Mode().Perm()); err != nil {
+		return err
+	}
+	if err := os.Chtimes(out.Name(), info.ModTime(), info.ModTime()); err != nil {
+		return err
+	}
+
+	return os.Rename(out.Name(), dst)
+}
+
+// FreeName returns path if it doesn't exist, otherwise the path with
+// a numeric suffix added before the extension, e.g. photo_1.jpg
+func FreeName(path string) string {
+	if !Exists(path) {
+		return path
+	}
+
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+	for i := 1; ; i++ {
+		candidate := fmt.Sprintf("%s_%d%s", base, i, ext)
+		if !Exists(candidate) {
+			return candidate
+		}
+	}
+}
+
+// IsAncestor returns true if a is a parent directory of b
+func IsAncestor(a, b string) bool {
+	return strings.HasPrefix(b, strings.TrimSuffix(a, string(filepath.Separator))+string(filepath.Separator))
+}
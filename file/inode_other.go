@@ -0,0 +1,13 @@
+//go:build !unix
+
+package file
+
+import (
+	"io/fs"
+)
+
+// Inode returns the device and inode numbers of a file,
+// not available on this platform
+func Inode(info fs.FileInfo) (uint64, uint64, bool) {
+	return 0, 0, false
+}
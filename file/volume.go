@@ -0,0 +1,113 @@
+package file
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// VolumeSeparator separates the volume from the path in paths of files
+// that aren't on the local file system, e.g. laptop:/home/user/img.jpg
+const VolumeSeparator = ":"
+
+// VolumeMarker is the name of the file marking the root directory of a volume,
+// it contains the name of the volume
+const VolumeMarker = ".godupe-volume"
+
+// VolumePath returns the path of a file on the given volume
+func VolumePath(volume, path string) string {
+	return volume + VolumeSeparator + path
+}
+
+// SplitVolumePath splits a path into the volume and the path on the volume.
+// ok is false for local paths.
+func SplitVolumePath(p string) (volume, path string, ok bool) {
+	if strings.HasPrefix(p, "/") {
+		return "", p, false
+	}
+	i := strings.Index(p, VolumeSeparator+"/")
+	// Single letters are Windows drive letters
+	if i < 2 || strings.ContainsAny(p[:i], `/\`) {
+		return "", p, false
+	}
+	return p[:i], p[i+len(VolumeSeparator):], true
+}
+
+// ValidVolumeName returns true if name can be used as a volume name
+func ValidVolumeName(name string) bool {
+	return len(name) >= 2 && !strings.ContainsAny(name, `/\:`+" \t\n") && name != ".."
+}
+
+// FindVolume returns the name and root directory of the volume holding path.
+// The root is the closest directory with a volume marker file, or the mount
+// point of the file system, named by its UUID.
+func FindVolume(path string) (name, root string, err error) {
+	path, err = filepath.Abs(path)
+	if err != nil {
+		return "", "", err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", "", err
+	}
+	device, _, hasDevice := Inode(info)
+
+	dir := path
+	if !info.IsDir() {
+		dir = filepath.Dir(path)
+	}
+	for {
+		if name := readVolumeMarker(dir); name != "" {
+			return name, dir, nil
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		// Mount points are where the device changes
+		if hasDevice {
+			parentInfo, err := os.Stat(parent)
+			if err != nil {
+				break
+			}
+			if parentDevice, _, _ := Inode(parentInfo); parentDevice != device {
+				break
+			}
+		}
+		dir = parent
+	}
+
+	if hasDevice {
+		if uuid := volumeUUID(device); uuid != "" {
+			return uuid, dir, nil
+		}
+	}
+
+	return "", "", fmt.Errorf("no volume found for %s, mark the volume root with a %s file", path, VolumeMarker)
+}
+
+// readVolumeMarker returns the volume name in the marker file of dir, if any
+func readVolumeMarker(dir string) string {
+	data, err := os.ReadFile(filepath.Join(dir, VolumeMarker))
+	if err != nil {
+		return ""
+	}
+	name := strings.TrimSpace(string(data))
+	if !ValidVolumeName(name) {
+		log.Warnf("Invalid volume name in %s: %q", filepath.Join(dir, VolumeMarker), name)
+		return ""
+	}
+	return name
+}
+
+// MarkVolume makes dir the root of a volume with the given name
+func MarkVolume(dir, name string) error {
+	if !ValidVolumeName(name) {
+		return fmt.Errorf("invalid volume name: %s", name)
+	}
+	return os.WriteFile(filepath.Join(dir, VolumeMarker), []byte(name+"\n"), 0644)
+}
@@ -0,0 +1,29 @@
+//go:build linux
+
+package file
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// volumeUUID returns the UUID of the file system on the given device
+func volumeUUID(device uint64) string {
+	const byUUID = "/dev/disk/by-uuid"
+
+	entries, err := os.ReadDir(byUUID)
+	if err != nil {
+		return ""
+	}
+	for _, entry := range entries {
+		var st syscall.Stat_t
+		if err := syscall.Stat(filepath.Join(byUUID, entry.Name()), &st); err != nil {
+			continue
+		}
+		if uint64(st.Rdev) == device {
+			return entry.Name()
+		}
+	}
+	return ""
+}
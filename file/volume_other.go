@@ -0,0 +1,9 @@
+//go:build !linux
+
+package file
+
+// volumeUUID returns the UUID of the file system on the given device,
+// only supported on Linux
+func volumeUUID(device uint64) string {
+	return ""
+}
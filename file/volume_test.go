@@ -0,0 +1,73 @@
+package file
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSplitVolumePath(t *testing.T) {
+	tests := []struct {
+		in     string
+		volume string
+		path   string
+		ok     bool
+	}{
+		{"nas:/photos/img.jpg", "nas", "/photos/img.jpg", true},
+		{"1a2b-3c4d:/", "1a2b-3c4d", "/", true},
+		{"/home/user/a:/b", "", "/home/user/a:/b", false},
+		{"/plain/path", "", "/plain/path", false},
+		// Windows drive letters aren't volumes
+		{"C:/Users/img.jpg", "", "C:/Users/img.jpg", false},
+		{"relative/dir:/x", "", "relative/dir:/x", false},
+		{"nas:relative", "", "nas:relative", false},
+		{"", "", "", false},
+	}
+
+	for _, tt := range tests {
+		volume, path, ok := SplitVolumePath(tt.in)
+		if volume != tt.volume || path != tt.path || ok != tt.ok {
+			t.Errorf("SplitVolumePath(%q) = %q, %q, %v, want %q, %q, %v", tt.in, volume, path, ok, tt.volume, tt.path, tt.ok)
+		}
+		if ok && VolumePath(volume, path) != tt.in {
+			t.Errorf("VolumePath(%q, %q) = %q, want %q", volume, path, VolumePath(volume, path), tt.in)
+		}
+	}
+}
+
+func TestValidVolumeName(t *testing.T) {
+	for name, want := range map[string]bool{
+		"nas":       true,
+		"1a2b-3c4d": true,
+		"usb.drive": true,
+		"c":         false,
+		"..":        false,
+		"a/b":       false,
+		"a:b":       false,
+		"my drive":  false,
+		"":          false,
+	} {
+		if got := ValidVolumeName(name); got != want {
+			t.Errorf("ValidVolumeName(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestFindVolumeMarker(t *testing.T) {
+	root := t.TempDir()
+	if err := MarkVolume(root, "backup"); err != nil {
+		t.Fatal(err)
+	}
+	sub := filepath.Join(root, "a", "b")
+	if err := os.MkdirAll(sub, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	name, found, err := FindVolume(sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "backup" || found != root {
+		t.Errorf("FindVolume(%q) = %q, %q, want backup, %q", sub, name, found, root)
+	}
+}
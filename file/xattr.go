@@ -0,0 +1,85 @@
+package file
+
+import (
+	"fmt"
+	"io/fs"
+	"strconv"
+)
+
+// Extended attributes the hashes of a file are stored in, as plain text
+const (
+	xattrAlgorithm   = "user.godupe.algorithm"
+	xattrHash        = "user.godupe.hash"
+	xattrPartialHash = "user.godupe.partialhash"
+	xattrPartialSize = "user.godupe.partialsize"
+	xattrSize        = "user.godupe.size"
+	xattrMtime       = "user.godupe.mtime"
+)
+
+// xattrAlgorithmSHA256 is the only supported hash algorithm
+const xattrAlgorithmSHA256 = "sha256"
+
+// XattrHashes are the hashes of a file stored in its extended attributes
+type XattrHashes struct {
+	Hash        string
+	PartialHash string
+	// PartialSize is the amount of bytes read for PartialHash
+	PartialSize int64
+	// Size and modification time of the file when it was hashed
+	Size  int64
+	Mtime int64
+}
+
+// Valid returns true if the hashes were calculated from the current contents of the file
+func (x XattrHashes) Valid(info fs.FileInfo) bool {
+	return (x.Hash != "" || x.PartialHash != "") && x.Size == info.Size() && x.Mtime == info.ModTime().UnixNano()
+}
+
+// ReadXattrs returns the hashes stored in the extended attributes of a file
+func ReadXattrs(path string) (XattrHashes, error) {
+	var x XattrHashes
+
+	algorithm, err := getXattr(path, xattrAlgorithm)
+	if err != nil {
+		return x, err
+	}
+	if algorithm != xattrAlgorithmSHA256 {
+		return x, fmt.Errorf("unknown hash algorithm: %s", algorithm)
+	}
+
+	// Files hashed only partially or fully don't have the other hash
+	x.Hash, _ = getXattr(path, xattrHash)
+	x.PartialHash, _ = getXattr(path, xattrPartialHash)
+
+	for name, value := range map[string]*int64{xattrPartialSize: &x.PartialSize, xattrSize: &x.Size, xattrMtime: &x.Mtime} {
+		s, err := getXattr(path, name)
+		if err != nil {
+			return x, err
+		}
+		*value, err = strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return x, fmt.Errorf("invalid %s: %w", name, err)
+		}
+	}
+
+	return x, nil
+}
+
+// WriteXattrs stores the hashes in the extended attributes of a file.
+// The modification time of the file doesn't change.
+func WriteXattrs(path string, x XattrHashes) error {
+	attrs := []struct{ name, value string }{
+		{xattrAlgorithm, xattrAlgorithmSHA256},
+		{xattrHash, x.Hash},
+		{xattrPartialHash, x.PartialHash},
+		{xattrPartialSize, strconv.FormatInt(x.PartialSize, 10)},
+		{xattrSize, strconv.FormatInt(x.Size, 10)},
+		{xattrMtime, strconv.FormatInt(x.Mtime, 10)},
+	}
+	for _, attr := range attrs {
+		if err := setXattr(path, attr.name, attr.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,19 @@
+//go:build !linux && !darwin
+
+package file
+
+import (
+	"errors"
+)
+
+// getXattr returns the value of an extended attribute,
+// not supported on this platform
+func getXattr(path, name string) (string, error) {
+	return "", errors.ErrUnsupported
+}
+
+// setXattr sets the value of an extended attribute,
+// not supported on this platform
+func setXattr(path, name, value string) error {
+	return errors.ErrUnsupported
+}
@@ -0,0 +1,63 @@
+package file
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestXattrs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(path, []byte("contents"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ReadXattrs(path); err == nil {
+		t.Error("ReadXattrs read hashes from a file without them")
+	}
+
+	want := XattrHashes{
+		PartialHash: "partial",
+		PartialSize: 4,
+		Size:        info.Size(),
+		Mtime:       info.ModTime().UnixNano(),
+	}
+	if err := WriteXattrs(path, want); err != nil {
+		if errors.Is(err, errors.ErrUnsupported) {
+			t.Skipf("extended attributes not supported: %s", err)
+		}
+		t.Fatal(err)
+	}
+
+	got, err := ReadXattrs(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Errorf("ReadXattrs = %+v, want %+v", got, want)
+	}
+
+	info, err = os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Valid(info) {
+		t.Error("hashes of an unchanged file aren't valid")
+	}
+
+	if err := os.WriteFile(path, []byte("modified contents"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	info, err = os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Valid(info) {
+		t.Error("hashes of a modified file are valid")
+	}
+}
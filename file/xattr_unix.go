@@ -0,0 +1,33 @@
+//go:build linux || darwin
+
+package file
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// getXattr returns the value of an extended attribute
+func getXattr(path, name string) (string, error) {
+	buf := make([]byte, 128)
+	for {
+		n, err := unix.Getxattr(path, name, buf)
+		if err == unix.ERANGE {
+			// Longer than the buffer, ask for the size
+			n, err = unix.Getxattr(path, name, nil)
+			if err != nil {
+				return "", err
+			}
+			buf = make([]byte, n)
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		return string(buf[:n]), nil
+	}
+}
+
+// setXattr sets the value of an extended attribute
+func setXattr(path, name, value string) error {
+	return unix.Setxattr(path, name, []byte(value), 0)
+}
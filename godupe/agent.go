@@ -0,0 +1,162 @@
+package godupe
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"regexp"
+
+	"github.com/lepinkainen/godupe/file"
+	log "github.com/sirupsen/logrus"
+)
+
+// Record is a file hashed by an agent. Agents stream records as newline
+// delimited JSON, one object per line
+type Record struct {
+	// Path is the absolute path on the agent's machine with forward slashes
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+	// Mtime is the modification time in nanoseconds since the epoch
+	Mtime int64 `json:"mtime"`
+	// Hash is the SHA-256 of the whole file, empty for large files hashed partially
+	Hash string `json:"hash,omitempty"`
+	// PartialHash is the SHA-256 of the start of the file when hashing partially
+	PartialHash string `json:"partial_hash,omitempty"`
+}
+
+// sha256Hex matches hex encoded SHA-256 hashes as the hashers produce them
+var sha256Hex = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// validHash returns true if a record hash is empty or a SHA-256
+func validHash(hash string) bool {
+	return hash == "" || sha256Hex.MatchString(hash)
+}
+
+// ingestBatchSize is the amount of records saved in a single transaction
+const ingestBatchSize = 1000
+
+// StreamRecords hashes every regular file under root and writes a Record for each to w.
+// Unreadable files are logged and skipped, the walk stops if writing fails.
+func StreamRecords(w io.Writer, root string, hasher *Hasher) error {
+	if hasher == nil {
+		hasher = NewHasher(HasherOptions{})
+	}
+
+	absroot, err := filepath.Abs(root)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(w)
+	return filepath.WalkDir(absroot, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if d == nil || path == absroot {
+				return err
+			}
+			log.Errorf("Error accessing %s: %s\n", path, err)
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		// Skip directories, links, devices and the volume marker
+		if !d.Type().IsRegular() || d.Name() == file.VolumeMarker {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			log.Errorf("Error reading file info %s: %s\n", path, err)
+			return nil
+		}
+		// Skip empty files
+		if info.Size() == 0 {
+			return nil
+		}
+
+		_, size, hash, err := hasher.HashFile(path, nil)
+		if err != nil {
+			log.Errorf("Error hashing file %s: %s\n", path, err)
+			return nil
+		}
+
+		rec := Record{Path: filepath.ToSlash(path), Size: size, Mtime: info.ModTime().UnixNano()}
+		if hasher.Partial() {
+			rec.PartialHash = hash
+			// Small files were read completely
+			if size < hasher.PartialSize() {
+				rec.Hash = hash
+			}
+		} else {
+			rec.Hash = hash
+		}
+
+		return enc.Encode(rec)
+	})
+}
+
+// Ingest reads the records streamed by an agent from r and saves them to
+// the store on the given volume, /srv/img.jpg becomes nas:/srv/img.jpg.
+// Returns the amount of files saved, records read before an error are kept.
+func Ingest(store *Store, r io.Reader, volume string) (int, error) {
+	if !file.ValidVolumeName(volume) {
+		return 0, fmt.Errorf("invalid volume name: %s", volume)
+	}
+
+	saved := 0
+	batch := make([]Entry, 0, ingestBatchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := store.SaveBatch(batch); err != nil {
+			return err
+		}
+		saved += len(batch)
+		batch = batch[:0]
+		return nil
+	}
+
+	dec := json.NewDecoder(r)
+	for {
+		var rec Record
+		err := dec.Decode(&rec)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if flushErr := flush(); flushErr != nil {
+				return saved, flushErr
+			}
+			return saved, err
+		}
+
+		if rec.Path == "" || (rec.Hash == "" && rec.PartialHash == "") {
+			log.Warnf("Skipping incomplete record: %+v", rec)
+			continue
+		}
+		if !validHash(rec.Hash) || !validHash(rec.PartialHash) {
+			log.Warnf("Skipping record with an invalid hash: %+v", rec)
+			continue
+		}
+
+		batch = append(batch, Entry{
+			Path:        file.VolumePath(volume, path.Clean("/"+rec.Path)),
+			Hash:        rec.Hash,
+			PartialHash: rec.PartialHash,
+			Size:        rec.Size,
+			Mtime:       rec.Mtime,
+		})
+		if len(batch) == ingestBatchSize {
+			if err := flush(); err != nil {
+				return saved, err
+			}
+		}
+	}
+
+	return saved, flush()
+}
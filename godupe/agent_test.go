@@ -0,0 +1,96 @@
+package godupe
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestStreamRecordsIngest(t *testing.T) {
+	dir := t.TempDir()
+	for name, data := range map[string]string{
+		"small.txt":     "small",
+		"sub/large.txt": strings.Repeat("large ", 100),
+		"empty":         "",
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var buf bytes.Buffer
+	err := StreamRecords(&buf, dir, NewHasher(HasherOptions{Partial: true, PartialSize: 100}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := openTestStore(t)
+	n, err := Ingest(store, &buf, "nas")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Empty files are skipped
+	if n != 2 {
+		t.Errorf("ingested %d files, want 2", n)
+	}
+
+	small, ok, err := store.Lookup("nas:" + filepath.ToSlash(filepath.Join(dir, "small.txt")))
+	if err != nil || !ok {
+		t.Fatalf("small.txt not stored: %v", err)
+	}
+	// Read completely, the partial hash is the full hash
+	if small.Hash == "" || small.Hash != small.PartialHash || small.Mtime == 0 {
+		t.Errorf("small.txt stored as %+v", small)
+	}
+	large, ok, err := store.Lookup("nas:" + filepath.ToSlash(filepath.Join(dir, "sub/large.txt")))
+	if err != nil || !ok {
+		t.Fatalf("large.txt not stored: %v", err)
+	}
+	if large.Hash != "" || large.PartialHash == "" || large.Size != 600 {
+		t.Errorf("large.txt stored as %+v", large)
+	}
+}
+
+func TestIngestInvalid(t *testing.T) {
+	store := openTestStore(t)
+	hash := strings.Repeat("ab", 32)
+
+	records := strings.Join([]string{
+		`{"path":"/ok","size":1,"hash":"` + hash + `"}`,
+		`{"path":"/dir/../cleaned","size":1,"hash":"` + hash + `"}`,
+		`{"path":"/nohash","size":1}`,
+		`{"path":"/invalid","size":1,"hash":"'; drop table dupes; --"}`,
+		`{"path":"/upper","size":1,"hash":"` + strings.ToUpper(hash) + `"}`,
+		`not json`,
+		`{"path":"/after","size":1,"hash":"` + hash + `"}`,
+	}, "\n")
+
+	n, err := Ingest(store, strings.NewReader(records), "nas")
+	if err == nil {
+		t.Error("Ingest read a malformed record")
+	}
+	// The records before the error are kept
+	if n != 2 {
+		t.Errorf("ingested %d files, want 2", n)
+	}
+
+	entries, err := store.Tree("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"nas:/cleaned", "nas:/ok"}
+	if got := entryPaths(entries); !reflect.DeepEqual(got, want) {
+		t.Errorf("stored %v, want %v", got, want)
+	}
+
+	if _, err := Ingest(store, strings.NewReader(""), "bad volume"); err == nil {
+		t.Error("Ingest accepted an invalid volume name")
+	}
+}
@@ -0,0 +1,46 @@
+// Package godupe finds duplicate files by hashing them into a SQLite DB.
+//
+// A Scanner walks directories, hashes files with a Hasher and saves the
+// hashes to a Store, which can then be queried for duplicates:
+//
+//	store, err := godupe.OpenStore(godupe.StoreOptions{Path: "godupe.db"})
+//	if err != nil {
+//		return err
+//	}
+//	defer store.Close()
+//
+//	scanner, err := godupe.NewScanner(godupe.ScannerOptions{Store: store})
+//	if err != nil {
+//		return err
+//	}
+//	err = scanner.Scan("/home/user/Pictures")
+//
+// Any fs.FS can be scanned instead of the local file system by setting
+// ScannerOptions.FS, its files are stored under ScannerOptions.Volume.
+package godupe
+
+import (
+	"errors"
+
+	"github.com/lepinkainen/godupe/db"
+)
+
+// Store is a DB of file hashes
+type Store = db.Store
+
+// Entry is a single file stored in a Store
+type Entry = db.Entry
+
+// StoreOptions configures a Store
+type StoreOptions struct {
+	// Path of the DB file, created if it doesn't exist
+	Path string
+}
+
+// OpenStore opens the DB, creating it and updating the tables as needed
+func OpenStore(opts StoreOptions) (*Store, error) {
+	if opts.Path == "" {
+		return nil, errors.New("no DB path given")
+	}
+	return db.Open(opts.Path)
+}
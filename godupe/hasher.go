@@ -0,0 +1,70 @@
+package godupe
+
+import (
+	"io"
+	"io/fs"
+
+	"github.com/lepinkainen/godupe/file"
+	"github.com/lepinkainen/godupe/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// DefaultPartialSize is the amount of bytes read for partial hashes by default
+const DefaultPartialSize = 2 * 1048576
+
+// HasherOptions configures a Hasher
+type HasherOptions struct {
+	// Partial only hashes the start of large files
+	Partial bool
+	// PartialSize is the amount of bytes read for partial hashes,
+	// DefaultPartialSize if not set
+	PartialSize int64
+}
+
+// Hasher calculates the SHA-256 hashes of file contents
+type Hasher struct {
+	partialSize int64
+}
+
+// NewHasher creates a Hasher
+func NewHasher(opts HasherOptions) *Hasher {
+	h := &Hasher{}
+	if opts.Partial {
+		h.partialSize = opts.PartialSize
+		if h.partialSize <= 0 {
+			h.partialSize = DefaultPartialSize
+		}
+	}
+	return h
+}
+
+// Partial returns true if only the start of large files is hashed
+func (h *Hasher) Partial() bool {
+	return h.partialSize > 0
+}
+
+// PartialSize returns the amount of bytes read for partial hashes, 0 for full hashes
+func (h *Hasher) PartialSize() int64 {
+	return h.partialSize
+}
+
+// HashFile returns the absolute path, size and hash of a file.
+// Bytes read are also written to progress, if given
+func (h *Hasher) HashFile(path string, progress io.Writer) (string, int64, string, error) {
+	defer prometheus.NewTimer(metrics.HashDuration).ObserveDuration()
+	return file.Hash(path, h.partialSize, metrics.CountBytes(progress))
+}
+
+// HashFS returns the size and hash of a file in fsys.
+// Bytes read are also written to progress, if given
+func (h *Hasher) HashFS(fsys fs.FS, name string, progress io.Writer) (int64, string, error) {
+	defer prometheus.NewTimer(metrics.HashDuration).ObserveDuration()
+	return file.HashFS(fsys, name, h.partialSize, metrics.CountBytes(progress))
+}
+
+// HashReader returns the hash of the contents of r, which is size bytes long.
+// Bytes read are also written to progress, if given
+func (h *Hasher) HashReader(r io.Reader, size int64, progress io.Writer) (string, error) {
+	defer prometheus.NewTimer(metrics.HashDuration).ObserveDuration()
+	return file.HashReader(r, size, h.partialSize, metrics.CountBytes(progress))
+}
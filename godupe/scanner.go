@@ -0,0 +1,887 @@
+package godupe
+
+import (
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/lepinkainen/godupe/cdc"
+	"github.com/lepinkainen/godupe/db"
+	"github.com/lepinkainen/godupe/file"
+	"github.com/lepinkainen/godupe/imagehash"
+	"github.com/lepinkainen/godupe/metrics"
+	"github.com/lepinkainen/godupe/progress"
+	log "github.com/sirupsen/logrus"
+)
+
+// Symlink policies
+const (
+	// SymlinksSkip ignores symbolic links
+	SymlinksSkip = "skip"
+	// SymlinksFollow hashes the targets of symbolic links as if they were in the link's place
+	SymlinksFollow = "follow"
+	// SymlinksRecord stores symbolic links and their targets without hashing
+	SymlinksRecord = "record"
+)
+
+// ScannerOptions configures a Scanner
+type ScannerOptions struct {
+	// Store the hashes are saved to, required
+	Store *Store
+	// Hasher for the file contents, full hashes if not set
+	Hasher *Hasher
+	// Volumes maps local paths to paths on volumes, optional
+	Volumes *Volumes
+	// Progress shows the progress of the scan, optional
+	Progress *progress.Reporter
+
+	// FS is scanned instead of the local file system, optional.
+	// Paths given to the Scan methods are then paths in FS, e.g. "." or "photos/2019"
+	FS fs.FS
+	// Volume is the name the files in FS are stored under, e.g. nas:/photos/img.jpg.
+	// Required with FS
+	Volume string
+
+	// Images also stores perceptual hashes of JPEG, PNG and GIF images
+	Images bool
+	// Archives also hashes files inside zip and tar archives
+	Archives bool
+	// Symlinks is the symlink policy, SymlinksSkip if not set
+	Symlinks string
+	// Cache skips the directories listed in the processed directory cache
+	Cache bool
+	// Xattrs stores the hashes in the extended attributes of local files
+	// and uses them instead of reading files that haven't changed since
+	Xattrs bool
+	// Chunks also stores the content defined chunks of the files, to find
+	// files sharing parts of their contents
+	Chunks bool
+	// ChunkSize is the average size of the chunks, cdc.DefaultAverageSize if not set
+	ChunkSize int
+	// MD5 also stores the MD5 of files read completely, so S3 objects with
+	// the same contents are found by their MD5 ETags without downloading them
+	MD5 bool
+}
+
+// Scanner walks directories and stores the hashes of the files in them
+type Scanner struct {
+	store    *Store
+	hasher   *Hasher
+	volumes  *Volumes
+	reporter *progress.Reporter
+	fsys     fs.FS
+	volume   string
+
+	images   bool
+	archives bool
+	symlinks string
+	cache    bool
+	xattrs   bool
+	chunks   bool
+	md5      bool
+	// average chunk size
+	chunkSize int
+
+	// followed holds the real paths of the scan roots and the directory symlinks
+	// currently being walked, to detect loops
+	followed []string
+}
+
+// NewScanner creates a Scanner
+func NewScanner(opts ScannerOptions) (*Scanner, error) {
+	if opts.Store == nil {
+		return nil, fmt.Errorf("no store given")
+	}
+
+	s := &Scanner{
+		store:     opts.Store,
+		hasher:    opts.Hasher,
+		volumes:   opts.Volumes,
+		reporter:  opts.Progress,
+		fsys:      opts.FS,
+		volume:    opts.Volume,
+		images:    opts.Images,
+		archives:  opts.Archives,
+		symlinks:  opts.Symlinks,
+		cache:     opts.Cache,
+		xattrs:    opts.Xattrs,
+		chunks:    opts.Chunks,
+		chunkSize: opts.ChunkSize,
+		md5:       opts.MD5,
+	}
+	if s.hasher == nil {
+		s.hasher = NewHasher(HasherOptions{})
+	}
+	if s.chunkSize == 0 {
+		s.chunkSize = cdc.DefaultAverageSize
+	}
+
+	if s.fsys != nil && !file.ValidVolumeName(s.volume) {
+		return nil, fmt.Errorf("invalid volume name for the file system: %q", s.volume)
+	}
+
+	switch s.symlinks {
+	case "":
+		s.symlinks = SymlinksSkip
+	case SymlinksSkip, SymlinksFollow, SymlinksRecord:
+	default:
+		return nil, fmt.Errorf("unknown symlink policy: %s", s.symlinks)
+	}
+
+	return s, nil
+}
+
+// DigestFS is a file system that can tell the digests of its files without
+// reading them, like object stores. Full hashes are taken from the SHA-256,
+// or copied from files with the same MD5.
+type DigestFS interface {
+	fs.FS
+	// Digests returns the hex SHA-256 and MD5 of the contents of a file,
+	// either is empty if not known
+	Digests(name string) (sha256, md5 string, err error)
+}
+
+// tree is a file system being scanned
+type tree struct {
+	fsys fs.FS
+	// dir is the local directory fsys is rooted at, empty for other file systems
+	dir string
+	// volume the files of other file systems are stored on
+	volume string
+}
+
+// localTree returns the tree of a local directory
+func localTree(dir string) tree {
+	return tree{fsys: os.DirFS(dir), dir: dir}
+}
+
+// local returns true for the local file system
+func (t tree) local() bool {
+	return t.dir != ""
+}
+
+// path returns the local path of a file, or its path on the volume for other file systems
+func (t tree) path(name string) string {
+	if t.local() {
+		return filepath.Join(t.dir, filepath.FromSlash(name))
+	}
+	return file.VolumePath(t.volume, path.Join("/", name))
+}
+
+// readLinkFS is a file system with symbolic links, same as fs.ReadLinkFS in newer Go versions
+type readLinkFS interface {
+	fs.FS
+	ReadLink(name string) (string, error)
+}
+
+// readLink returns the target of a symbolic link
+func (t tree) readLink(name string) (string, error) {
+	if t.local() {
+		return os.Readlink(t.path(name))
+	}
+	if fsys, ok := t.fsys.(readLinkFS); ok {
+		return fsys.ReadLink(name)
+	}
+	return "", &fs.PathError{Op: "readlink", Path: name, Err: errors.ErrUnsupported}
+}
+
+// key returns the path a file is stored with
+func (s *Scanner) key(t tree, name string) string {
+	if t.local() {
+		return s.volumes.DBPath(t.path(name))
+	}
+	return t.path(name)
+}
+
+// locate returns the tree holding the file at p and the name of the file in it
+func (s *Scanner) locate(p string) (tree, string, error) {
+	if s.fsys != nil {
+		if !fs.ValidPath(p) {
+			return tree{}, "", &fs.PathError{Op: "scan", Path: p, Err: fs.ErrInvalid}
+		}
+		return tree{fsys: s.fsys, volume: s.volume}, p, nil
+	}
+
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return tree{}, "", err
+	}
+	return localTree(filepath.Dir(abs)), filepath.Base(abs), nil
+}
+
+// Scan hashes all files under root
+func (s *Scanner) Scan(root string) error {
+	t, name, err := s.locate(root)
+	if err != nil {
+		return err
+	}
+
+	if t.local() {
+		// Local directories are walked as their own tree
+		if info, err := os.Stat(t.path(name)); err == nil && info.IsDir() {
+			t, name = localTree(t.path(name)), "."
+		}
+
+		if s.symlinks == SymlinksFollow {
+			real, err := filepath.EvalSymlinks(t.path(name))
+			if err != nil {
+				return err
+			}
+			s.followed = append(s.followed, real)
+			defer func() { s.followed = s.followed[:len(s.followed)-1] }()
+		}
+	}
+
+	return fs.WalkDir(t.fsys, name, s.walkDirFunc(t))
+}
+
+// hashSufficient returns true if a file with the given hash type doesn't need to be hashed again
+func (s *Scanner) hashSufficient(res db.HashType) bool {
+	if s.hasher.Partial() {
+		return res == db.HashTypePartial || res == db.HashTypeFull
+	}
+	return res == db.HashTypeFull
+}
+
+// hashedLink returns an already hashed path pointing to the same inode, if any
+func (s *Scanner) hashedLink(path string, info fs.FileInfo, device, inode uint64) (string, error) {
+	others, err := s.store.FindInode(device, inode, info.Size())
+	if err != nil {
+		return "", err
+	}
+	for _, other := range others {
+		if other.Path == path {
+			continue
+		}
+		local, ok := s.volumes.LocalPath(other.Path)
+		if !ok {
+			continue
+		}
+		// Inode numbers get reused, make sure it's still the same file
+		otherInfo, err := os.Stat(local)
+		if err != nil || !os.SameFile(info, otherInfo) {
+			continue
+		}
+		res, err := s.store.Exists(other.Path)
+		if err != nil {
+			return "", err
+		}
+		if s.hashSufficient(res) {
+			return other.Path, nil
+		}
+	}
+	return "", nil
+}
+
+// movedFrom returns the old path of a file that has been moved or renamed since it was hashed.
+// The old path must be gone and the inode, size and modification time unchanged.
+func (s *Scanner) movedFrom(path string, info fs.FileInfo, device, inode uint64) (string, error) {
+	others, err := s.store.FindInode(device, inode, info.Size())
+	if err != nil {
+		return "", err
+	}
+	for _, other := range others {
+		if other.Path == path || other.Target != "" || other.Mtime != info.ModTime().UnixNano() {
+			continue
+		}
+		// Files on volumes that aren't mounted don't exist locally, but haven't moved
+		local, ok := s.volumes.LocalPath(other.Path)
+		if !ok {
+			continue
+		}
+		if _, err := os.Lstat(local); !os.IsNotExist(err) {
+			continue
+		}
+		res, err := s.store.Exists(other.Path)
+		if err != nil {
+			return "", err
+		}
+		if s.hashSufficient(res) {
+			return other.Path, nil
+		}
+	}
+	return "", nil
+}
+
+// skip counts a file that didn't need to be read
+func (s *Scanner) skip(size int64) {
+	s.reporter.Skip(size)
+	metrics.FilesSkipped.Inc()
+}
+
+// hashImage stores the perceptual hashes of an image file, if not stored yet
+func (s *Scanner) hashImage(t tree, name string) error {
+	key := s.key(t, name)
+	if !s.images || !imagehash.IsImage(name) {
+		return nil
+	}
+	if exists, err := s.store.ImageExists(key); err != nil || exists {
+		return err
+	}
+
+	f, err := t.fsys.Open(name)
+	if err != nil {
+		log.Warnf("Error hashing image %s: %s\n", t.path(name), err)
+		metrics.Error("image")
+		return nil
+	}
+	defer f.Close()
+
+	phash, dhash, err := imagehash.Hash(f)
+	if err != nil {
+		log.Warnf("Error hashing image %s: %s\n", t.path(name), err)
+		metrics.Error("image")
+		return nil
+	}
+
+	return s.store.SaveImage(key, imagehash.Format(phash), imagehash.Format(dhash))
+}
+
+// hashArchive stores the hashes of the files inside an archive, if not stored yet.
+// Members are stored with virtual paths like archive.zip!/dir/file.jpg
+func (s *Scanner) hashArchive(t tree, name string) error {
+	key := s.key(t, name)
+	if !s.archives || !file.IsArchive(name) {
+		return nil
+	}
+	if scanned, err := s.archiveScanned(key); err != nil || scanned {
+		return err
+	}
+
+	log.Debugf("hashing archive: %s\n", t.path(name))
+
+	// Errors saving the members are returned, unreadable archives are only logged
+	var saveErr error
+	err := file.WalkArchive(t.fsys, name, func(member string, size int64, r io.Reader) error {
+		// Skip empty files
+		if size == 0 {
+			return nil
+		}
+		hash, err := s.hasher.HashReader(r, size, nil)
+		if err != nil {
+			return err
+		}
+		saveErr = s.store.Save(file.ArchivePath(key, member), size, hash, s.hasher.PartialSize())
+		return saveErr
+	})
+	if saveErr != nil {
+		return saveErr
+	}
+	if err != nil {
+		log.Errorf("Error reading archive %s: %s\n", t.path(name), err)
+		metrics.Error("archive")
+	}
+	return nil
+}
+
+// chunkFile stores the content defined chunks of a file, if not stored yet
+func (s *Scanner) chunkFile(t tree, name string) error {
+	key := s.key(t, name)
+	if !s.chunks {
+		return nil
+	}
+	if exists, err := s.store.ChunksExist(key); err != nil || exists {
+		return err
+	}
+
+	log.Debugf("chunking: %s\n", t.path(name))
+
+	f, err := t.fsys.Open(name)
+	if err != nil {
+		log.Warnf("Error chunking file %s: %s\n", t.path(name), err)
+		metrics.Error("chunk")
+		return nil
+	}
+	defer f.Close()
+
+	// Files that weren't read completely by the hasher are read again
+	chunks, err := cdc.All(io.TeeReader(f, metrics.CountBytes(s.reporter)), s.chunkSize)
+	if err != nil {
+		log.Warnf("Error chunking file %s: %s\n", t.path(name), err)
+		metrics.Error("chunk")
+		return nil
+	}
+
+	return s.store.SaveChunks(key, storedChunks(chunks))
+}
+
+// scanExtras does the optional image, archive and chunk passes for a stored file
+func (s *Scanner) scanExtras(t tree, name string) error {
+	if err := s.hashImage(t, name); err != nil {
+		return err
+	}
+	if err := s.hashArchive(t, name); err != nil {
+		return err
+	}
+	return s.chunkFile(t, name)
+}
+
+// storedChunks converts chunks to the type they're stored as
+func storedChunks(chunks []cdc.Chunk) []db.Chunk {
+	stored := make([]db.Chunk, len(chunks))
+	for i, c := range chunks {
+		stored[i] = db.Chunk{Offset: c.Offset, Size: c.Size, Hash: c.Hash}
+	}
+	return stored
+}
+
+// archiveScanned returns true if the archive's members are stored with the needed hash type
+func (s *Scanner) archiveScanned(path string) (bool, error) {
+	members, err := s.store.Tree(path + "!")
+	if err != nil || len(members) == 0 {
+		return false, err
+	}
+	if s.hasher.Partial() {
+		return true, nil
+	}
+	for _, m := range members {
+		if m.Hash == "" {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// extrasExistAll returns true if the optional image, archive and chunk passes have
+// already been done for all files in the list, given as stored
+func (s *Scanner) extrasExistAll(files []string) (bool, error) {
+	for _, f := range files {
+		if s.images && imagehash.IsImage(f) {
+			if exists, err := s.store.ImageExists(f); err != nil || !exists {
+				return false, err
+			}
+		}
+		if s.archives && file.IsArchive(f) {
+			if scanned, err := s.archiveScanned(f); err != nil || !scanned {
+				return false, err
+			}
+		}
+		if s.chunks {
+			if exists, err := s.store.ChunksExist(f); err != nil || !exists {
+				return false, err
+			}
+		}
+	}
+	return true, nil
+}
+
+// walkDirFunc returns the function walking the tree t
+func (s *Scanner) walkDirFunc(t tree) fs.WalkDirFunc {
+	return func(name string, d fs.DirEntry, err error) error {
+		path := t.path(name)
+		if err != nil {
+			log.Errorf("Error accessing directory: %s\n", path)
+			metrics.Error("walk")
+			return err
+		}
+
+		var hasSubdirs = false
+
+		// If this is a directory, check for subdirs and set flag
+		if d.IsDir() {
+			hasSubdirs, err = file.HasSubdirectories(t.fsys, name)
+			if err != nil {
+				log.Errorf("error determining subdirectories %v", err)
+				metrics.Error("walk")
+				return err
+			}
+		}
+
+		// The cache only lists local directories
+		if s.cache && t.local() {
+			cachedDirs := file.LoadCachedDirs()
+
+			// Skip if directory is in cache and doesn't have subdirectories
+			// else the subrids will never be processed
+			if !hasSubdirs {
+				if d.IsDir() && file.ContainsDir(cachedDirs, path) {
+					log.Infof("Skipping cached directory: %s (no subdirectories)", path)
+					s.reporter.SkipDir(path)
+					return fs.SkipDir
+				}
+			}
+		}
+
+		// Skip if all files are already in database
+		if d.IsDir() {
+
+			files, err := file.WalkDirFiles(t.fsys, name, s.symlinks != SymlinksSkip)
+			log.Debugf("processing: %s [%d files]\n", path, len(files))
+			if err != nil {
+				return err
+			}
+
+			stored := make([]string, len(files))
+			for i, f := range files {
+				stored[i] = s.key(t, f)
+			}
+			skip, err := s.store.ExistsAll(stored, s.hasher.Partial())
+			if err != nil {
+				return err
+			}
+			if skip {
+				skip, err = s.extrasExistAll(stored)
+				if err != nil {
+					return err
+				}
+			}
+
+			// skip directories that have been fully processed (every file exists in DB)
+			if skip {
+				log.Debug("-> Skip - already processed")
+
+				if s.cache && t.local() {
+					log.Infof("Caching: %s", path)
+					file.AddDirToCache(path)
+				}
+
+				// only fully skip directories with no subdirs
+				if !hasSubdirs {
+					s.reporter.SkipDir(path)
+					return fs.SkipDir
+				} else {
+					return nil
+				}
+			}
+
+			// don't process directories in general
+			return nil
+		}
+
+		// Links are handled according to the symlink policy
+		if d.Type()&fs.ModeSymlink != 0 {
+			return s.scanSymlink(t, name)
+		}
+
+		// Skip devices, pipes and sockets, reading them could block forever
+		if !d.Type().IsRegular() || d.Name() == file.VolumeMarker {
+			log.Debugf("skipping special file: %s\n", path)
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			log.Errorf("Error reading file info %s: %s\n", path, err)
+			metrics.Error("stat")
+			return err
+		}
+
+		return s.scanFile(t, name, info)
+	}
+}
+
+// ScanFile hashes a single regular file and stores it, unless already stored
+func (s *Scanner) ScanFile(path string, info fs.FileInfo) error {
+	t, name, err := s.locate(path)
+	if err != nil {
+		log.Errorf("Error getting absolute path for %s: %s\n", path, err)
+		return err
+	}
+	return s.scanFile(t, name, info)
+}
+
+func (s *Scanner) scanFile(t tree, name string, info fs.FileInfo) error {
+	path := t.path(name)
+
+	// Handle potential panics during file access
+	defer func() {
+		if x := recover(); x != nil {
+			log.Errorf("Unreadable file: %s\n", path)
+			log.Errorf("Recovered in %s", x)
+			metrics.Error("read")
+		}
+	}()
+
+	key := s.key(t, name)
+
+	// Check if file already exists based on hash type
+	res, err := s.store.Exists(key)
+	if err != nil {
+		return err
+	}
+	if s.hashSufficient(res) {
+		log.Debugf("skipping: %s\n", path)
+		s.skip(info.Size())
+		return s.scanExtras(t, name)
+	}
+
+	// Hardlinks share their content, no need to hash the same inode twice.
+	// The other paths can only be checked on the local file system
+	device, inode, hasInode := file.Inode(info)
+	if hasInode && t.local() && info.Size() > 0 {
+		linked, err := s.hashedLink(key, info, device, inode)
+		if err != nil {
+			return err
+		}
+		if linked != "" {
+			log.Debugf("hardlink: %s -> %s\n", path, linked)
+			s.skip(info.Size())
+			return s.store.SaveLink(key, linked, device, inode, info.ModTime().UnixNano())
+		}
+
+		// Moved files can keep their hash
+		moved, err := s.movedFrom(key, info, device, inode)
+		if err != nil {
+			return err
+		}
+		if moved != "" {
+			log.Infof("Moved: %s -> %s", moved, key)
+			s.skip(info.Size())
+			return s.store.Move(moved, key)
+		}
+	}
+
+	// Hashes stored with the file are used if the file hasn't changed since
+	var attrs file.XattrHashes
+	if s.xattrs && t.local() {
+		attrs, _ = file.ReadXattrs(path)
+		if !attrs.Valid(info) {
+			attrs = file.XattrHashes{}
+		}
+		if hash := s.xattrHash(attrs); hash != "" {
+			log.Debugf("hash from xattrs: %s\n", path)
+			if err := s.saveHash(key, info, info.Size(), hash, s.hasher.PartialSize(), ""); err != nil {
+				return err
+			}
+			s.skip(info.Size())
+			return s.scanExtras(t, name)
+		}
+	}
+
+	// Object stores can tell the hash without downloading the file
+	var md5sum string
+	if fsys, ok := t.fsys.(DigestFS); ok && !s.hasher.Partial() && info.Size() > 0 {
+		var sum string
+		sum, md5sum, err = s.knownHash(fsys, name, info.Size())
+		if err != nil {
+			return err
+		}
+		if sum != "" {
+			log.Debugf("known hash: %s\n", path)
+			if err := s.saveHash(key, info, info.Size(), sum, 0, md5sum); err != nil {
+				return err
+			}
+			s.skip(info.Size())
+			return s.scanExtras(t, name)
+		}
+	}
+
+	// MD5s and chunks of files read completely are taken in the same pass as the hash
+	fullRead := !s.hasher.Partial() || info.Size() <= s.hasher.PartialSize()
+	writers := []io.Writer{s.reporter}
+	md5Hash := md5.New()
+	if s.md5 && fullRead && md5sum == "" {
+		writers = append(writers, md5Hash)
+	}
+	var chunker *cdc.Writer
+	if s.chunks && fullRead {
+		exists, err := s.store.ChunksExist(key)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			chunker = cdc.NewWriter(s.chunkSize)
+			writers = append(writers, chunker)
+		}
+	}
+
+	// Perform file operations
+	s.reporter.StartFile(path)
+	size, hash, err := s.hasher.HashFS(t.fsys, name, io.MultiWriter(writers...))
+	if err != nil {
+		log.Errorf("Error hashing file %s: %s\n", path, err)
+		metrics.Error("hash")
+		return err
+	}
+	s.reporter.FileDone(size)
+	metrics.FilesHashed.Inc()
+
+	// Skip empty files
+	if size == 0 {
+		log.Debugf("skipping empty file: %s\n", path)
+		return nil
+	}
+
+	if s.md5 && fullRead && md5sum == "" {
+		md5sum = fmt.Sprintf("%x", md5Hash.Sum(nil))
+	}
+	if err := s.saveHash(key, info, size, hash, s.hasher.PartialSize(), md5sum); err != nil {
+		return err
+	}
+	if s.xattrs && t.local() {
+		s.writeXattrs(path, attrs, info, hash)
+	}
+	if chunker != nil {
+		chunker.Close()
+		if err := s.store.SaveChunks(key, storedChunks(chunker.Chunks())); err != nil {
+			return err
+		}
+	}
+
+	return s.scanExtras(t, name)
+}
+
+// saveHash stores the hash of a file with its stat and MD5, if known
+func (s *Scanner) saveHash(key string, info fs.FileInfo, size int64, hash string, partialSize int64, md5sum string) error {
+	if err := s.store.Save(key, size, hash, partialSize); err != nil {
+		return err
+	}
+	device, inode, _ := file.Inode(info)
+	if err := s.store.SetStat(key, device, inode, info.ModTime().UnixNano()); err != nil {
+		return err
+	}
+	if md5sum != "" {
+		return s.store.SetMD5(key, md5sum)
+	}
+	return nil
+}
+
+// xattrHash returns the hash needed by the hasher from valid xattrs, if stored
+func (s *Scanner) xattrHash(attrs file.XattrHashes) string {
+	if !s.hasher.Partial() {
+		return attrs.Hash
+	}
+	// Files smaller than the partial size are hashed completely
+	if attrs.Size < s.hasher.PartialSize() && attrs.Hash != "" {
+		return attrs.Hash
+	}
+	if attrs.PartialSize == s.hasher.PartialSize() {
+		return attrs.PartialHash
+	}
+	return ""
+}
+
+// writeXattrs stores a new hash of a file in its xattrs,
+// keeping the valid hash of the other type
+func (s *Scanner) writeXattrs(path string, attrs file.XattrHashes, info fs.FileInfo, hash string) {
+	attrs.Size = info.Size()
+	attrs.Mtime = info.ModTime().UnixNano()
+	if !s.hasher.Partial() || info.Size() < s.hasher.PartialSize() {
+		attrs.Hash = hash
+	}
+	if s.hasher.Partial() {
+		attrs.PartialHash = hash
+		attrs.PartialSize = s.hasher.PartialSize()
+	}
+
+	// Read-only files and file systems without xattrs are hashed again next time
+	if err := file.WriteXattrs(path, attrs); err != nil {
+		log.Debugf("Error writing xattrs of %s: %s\n", path, err)
+	}
+}
+
+// knownHash returns the SHA-256 of a file if the file system or an already
+// hashed file with the same MD5 tells it, and the MD5 if known
+func (s *Scanner) knownHash(fsys DigestFS, name string, size int64) (string, string, error) {
+	sum, md5, err := fsys.Digests(name)
+	if err != nil {
+		log.Debugf("Error reading digests of %s: %s\n", name, err)
+		return "", "", nil
+	}
+	if sum != "" || md5 == "" {
+		return sum, md5, nil
+	}
+
+	others, err := s.store.FindMD5(md5, size)
+	if err != nil {
+		return "", "", err
+	}
+	for _, other := range others {
+		if other.Hash != "" {
+			return other.Hash, md5, nil
+		}
+	}
+	return "", md5, nil
+}
+
+// symlinkLoop returns true if walking the real directory dir from the link at
+// path would end up walking the link again
+func (s *Scanner) symlinkLoop(path, dir string) bool {
+	parent, err := filepath.EvalSymlinks(filepath.Dir(path))
+	if err != nil {
+		return true
+	}
+	for _, walked := range append(s.followed, parent) {
+		if dir == walked || file.IsAncestor(dir, walked) {
+			return true
+		}
+	}
+	return false
+}
+
+// ScanSymlink handles a symbolic link according to the symlink policy
+func (s *Scanner) ScanSymlink(path string) error {
+	t, name, err := s.locate(path)
+	if err != nil {
+		log.Errorf("Error getting absolute path for %s: %s\n", path, err)
+		return err
+	}
+	return s.scanSymlink(t, name)
+}
+
+func (s *Scanner) scanSymlink(t tree, name string) error {
+	path := t.path(name)
+
+	target, err := t.readLink(name)
+	if err != nil {
+		log.Errorf("Error reading symlink %s: %s\n", path, err)
+		metrics.Error("readlink")
+		return nil
+	}
+
+	key := s.key(t, name)
+
+	switch s.symlinks {
+	case SymlinksRecord:
+		log.Debugf("recording symlink: %s -> %s\n", path, target)
+		return s.store.SaveSymlink(key, target)
+	case SymlinksFollow:
+		info, err := fs.Stat(t.fsys, name)
+		if err != nil {
+			log.Warnf("Broken symlink %s -> %s\n", path, target)
+			return nil
+		}
+
+		if info.IsDir() {
+			// Loops can only be detected on the local file system
+			if !t.local() {
+				log.Warnf("Not following directory symlink outside the local file system: %s -> %s\n", path, target)
+				return nil
+			}
+
+			dir, err := filepath.EvalSymlinks(path)
+			if err != nil || s.symlinkLoop(path, dir) {
+				log.Warnf("Symlink loop, skipping: %s -> %s\n", path, target)
+				return nil
+			}
+
+			s.followed = append(s.followed, dir)
+			defer func() { s.followed = s.followed[:len(s.followed)-1] }()
+
+			// The link is walked as its own tree to keep the paths under the link
+			link := localTree(path)
+			return fs.WalkDir(link.fsys, ".", s.walkDirFunc(link))
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		err = s.scanFile(t, name, info)
+		if err != nil {
+			return err
+		}
+		res, err := s.store.Exists(key)
+		if err != nil || res == db.HashTypeNotExist {
+			return err
+		}
+		return s.store.SetLinkTarget(key, target)
+	default:
+		log.Debugf("skipping symlink: %s\n", path)
+		return nil
+	}
+}
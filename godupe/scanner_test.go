@@ -0,0 +1,278 @@
+package godupe
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/lepinkainen/godupe/db"
+	"github.com/lepinkainen/godupe/metrics"
+)
+
+// testFS returns a file system with two copies of the same file,
+// an empty file, a unique file and a zip holding a third copy
+func testFS(t *testing.T) fstest.MapFS {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.Create("inner/copy.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("duplicate contents"))
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return fstest.MapFS{
+		"a.txt":          {Data: []byte("duplicate contents")},
+		"sub/b.txt":      {Data: []byte("duplicate contents")},
+		"sub/empty":      {Data: nil},
+		"sub/unique.txt": {Data: []byte(strings.Repeat("unique ", 1000))},
+		"files.zip":      {Data: buf.Bytes()},
+	}
+}
+
+// testScan scans fsys as the volume mem into a new store
+func testScan(t *testing.T, store *Store, fsys fstest.MapFS, opts ScannerOptions) {
+	opts.Store = store
+	opts.FS = fsys
+	opts.Volume = "mem"
+	scanner, err := NewScanner(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := scanner.Scan("."); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// tempDir writes files to a temporary directory
+func tempDir(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// scanLocal scans a local directory into store
+func scanLocal(t *testing.T, store *Store, dir string, opts ScannerOptions) {
+	opts.Store = store
+	scanner, err := NewScanner(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := scanner.Scan(dir); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func openTestStore(t *testing.T) *Store {
+	store, err := OpenStore(StoreOptions{Path: filepath.Join(t.TempDir(), "test.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+// entryPaths returns the sorted paths of entries
+func entryPaths(entries []Entry) []string {
+	var paths []string
+	for _, e := range entries {
+		paths = append(paths, e.Path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func TestScanFS(t *testing.T) {
+	store := openTestStore(t)
+	fsys := testFS(t)
+
+	testScan(t, store, fsys, ScannerOptions{Archives: true})
+
+	entries, err := store.Tree("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Empty files are skipped
+	want := []string{"mem:/a.txt", "mem:/files.zip", "mem:/files.zip!/inner/copy.txt", "mem:/sub/b.txt", "mem:/sub/unique.txt"}
+	if got := entryPaths(entries); !reflect.DeepEqual(got, want) {
+		t.Errorf("stored %v, want %v", got, want)
+	}
+
+	dupes, err := store.Duplicates("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []string{"mem:/a.txt", "mem:/files.zip!/inner/copy.txt", "mem:/sub/b.txt"}
+	if got := entryPaths(dupes); !reflect.DeepEqual(got, want) {
+		t.Errorf("duplicates %v, want %v", got, want)
+	}
+
+	// Nothing has changed, only the empty file isn't stored and is read again
+	hashed := metrics.Value(metrics.FilesHashed)
+	testScan(t, store, fsys, ScannerOptions{Archives: true})
+	if n := metrics.Value(metrics.FilesHashed) - hashed; n != 1 {
+		t.Errorf("rescan hashed %v files, want 1", n)
+	}
+}
+
+func TestScanPartial(t *testing.T) {
+	store := openTestStore(t)
+
+	testScan(t, store, testFS(t), ScannerOptions{
+		Hasher: NewHasher(HasherOptions{Partial: true, PartialSize: 100}),
+	})
+
+	for path, want := range map[string]db.HashType{
+		// Smaller than the partial size, hashed completely
+		"mem:/a.txt":          db.HashTypeFull,
+		"mem:/sub/unique.txt": db.HashTypePartial,
+	} {
+		got, err := store.Exists(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("%s hashed %s, want %s", path, got, want)
+		}
+	}
+}
+
+func TestScanChunks(t *testing.T) {
+	store := openTestStore(t)
+
+	testScan(t, store, testFS(t), ScannerOptions{Chunks: true, ChunkSize: 1024})
+
+	total, _, err := store.ChunkUsage("mem:/sub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := int64(len("duplicate contents") + len(strings.Repeat("unique ", 1000))); total != want {
+		t.Errorf("chunks of mem:/sub cover %d bytes, want %d", total, want)
+	}
+}
+
+func TestScanSymlinks(t *testing.T) {
+	dir := tempDir(t, map[string]string{"real/file": "contents"})
+	for link, target := range map[string]string{
+		"file.lnk": "real/file",
+		"dir.lnk":  "real",
+		// Following would walk real again and again
+		"real/loop": "..",
+		"broken":    "nothing",
+	} {
+		if err := os.Symlink(target, filepath.Join(dir, link)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	path := func(name string) string { return filepath.Join(dir, name) }
+
+	tests := []struct {
+		policy string
+		want   []string
+	}{
+		{SymlinksSkip, []string{path("real/file")}},
+		{SymlinksRecord, []string{path("broken"), path("dir.lnk"), path("file.lnk"), path("real/file"), path("real/loop")}},
+		{SymlinksFollow, []string{path("dir.lnk/file"), path("file.lnk"), path("real/file")}},
+	}
+	for _, tt := range tests {
+		store := openTestStore(t)
+		scanLocal(t, store, dir, ScannerOptions{Symlinks: tt.policy})
+
+		entries, err := store.Tree(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := entryPaths(entries); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: stored %v, want %v", tt.policy, got, tt.want)
+		}
+
+		link, ok, err := store.Lookup(path("file.lnk"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch tt.policy {
+		case SymlinksRecord:
+			if link.Target != "real/file" || link.Hash != "" {
+				t.Errorf("recorded %+v, want the target without a hash", link)
+			}
+		case SymlinksFollow:
+			real, _, err := store.Lookup(path("real/file"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !ok || link.Target != "real/file" || link.Hash != real.Hash {
+				t.Errorf("followed %+v, want the hash of the target", link)
+			}
+		}
+	}
+
+	if _, err := NewScanner(ScannerOptions{Store: openTestStore(t), Symlinks: "unknown"}); err == nil {
+		t.Error("NewScanner accepted an unknown symlink policy")
+	}
+}
+
+func TestScanMoved(t *testing.T) {
+	dir := tempDir(t, map[string]string{
+		"old":        "renamed",
+		"olddir/f":   "in a renamed directory",
+		"edited":     "before",
+		"unmodified": "stays",
+	})
+	path := func(name string) string { return filepath.Join(dir, name) }
+	store := openTestStore(t)
+	scanLocal(t, store, dir, ScannerOptions{})
+
+	old, _, err := store.Lookup(path("old"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for from, to := range map[string]string{"old": "new", "olddir": "newdir", "edited": "edited.bak"} {
+		if err := os.Rename(path(from), path(to)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Moved and changed, the old hash is stale
+	if err := os.WriteFile(path("edited.bak"), []byte("after the move"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	hashed := metrics.Value(metrics.FilesHashed)
+	scanLocal(t, store, dir, ScannerOptions{})
+	if n := metrics.Value(metrics.FilesHashed) - hashed; n != 1 {
+		t.Errorf("rescan hashed %v files, want 1", n)
+	}
+
+	entries, err := store.Tree(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The edited file wasn't detected as moved, its old path stays stored
+	want := []string{path("edited"), path("edited.bak"), path("new"), path("newdir/f"), path("unmodified")}
+	if got := entryPaths(entries); !reflect.DeepEqual(got, want) {
+		t.Errorf("stored %v, want %v", got, want)
+	}
+
+	moved, _, err := store.Lookup(path("new"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if moved.Hash != old.Hash || moved.Mtime != old.Mtime {
+		t.Errorf("moved file stored as %+v, want the hash and stat of %+v", moved, old)
+	}
+}
@@ -0,0 +1,123 @@
+package godupe
+
+import (
+	"path/filepath"
+
+	"github.com/lepinkainen/godupe/file"
+	log "github.com/sirupsen/logrus"
+)
+
+// Volumes maps local paths to paths on the known volumes mounted on this machine.
+//
+// Files on volumes are stored relative to the volume root, e.g.
+// 1a2b-3c4d:/photos/img.jpg instead of /media/usb0/photos/img.jpg, so the
+// same drive is recognised wherever it's mounted. A nil Volumes stores all
+// files with their local paths.
+type Volumes struct {
+	store *Store
+	// roots of the mounted volumes by name
+	mounted map[string]string
+}
+
+// LoadVolumes finds which of the volumes in the store are mounted
+func LoadVolumes(store *Store) (*Volumes, error) {
+	volumes, err := store.Volumes()
+	if err != nil {
+		return nil, err
+	}
+
+	v := &Volumes{store: store, mounted: map[string]string{}}
+	for _, vol := range volumes {
+		if name, root, err := file.FindVolume(vol.Root); err == nil && name == vol.Name && root == vol.Root {
+			v.mounted[vol.Name] = vol.Root
+		}
+	}
+	return v, nil
+}
+
+// Register stores paths under dir on the volume holding it. Unless required,
+// only volumes already in the store are used, they might be mounted somewhere else now.
+func (v *Volumes) Register(dir string, required bool) error {
+	name, root, err := file.FindVolume(dir)
+	if err != nil {
+		if required {
+			return err
+		}
+		return nil
+	}
+
+	volumes, err := v.store.Volumes()
+	if err != nil {
+		return err
+	}
+	known := false
+	for _, vol := range volumes {
+		known = known || vol.Name == name
+	}
+	if !known && !required {
+		return nil
+	}
+
+	if v.mounted[name] != root {
+		log.Infof("Volume %s at %s", name, root)
+	}
+	// Files scanned before the volume was known keep their hashes
+	if !known {
+		if err := v.store.MoveTree(root, file.VolumePath(name, "")); err != nil {
+			return err
+		}
+	}
+	if err := v.store.SaveVolume(name, root); err != nil {
+		return err
+	}
+	v.mounted[name] = root
+
+	return nil
+}
+
+// Mounted returns the root of a mounted volume
+func (v *Volumes) Mounted(name string) (string, bool) {
+	if v == nil {
+		return "", false
+	}
+	root, ok := v.mounted[name]
+	return root, ok
+}
+
+// DBPath returns the path a local file is stored with
+func (v *Volumes) DBPath(path string) string {
+	if v == nil {
+		return path
+	}
+
+	var name, root string
+	for n, r := range v.mounted {
+		// Marked directories can be inside other volumes, use the closest one
+		if (path == r || file.IsAncestor(r, path)) && len(r) > len(root) {
+			name, root = n, r
+		}
+	}
+	if name == "" {
+		return path
+	}
+
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == "." {
+		rel = ""
+	}
+	return file.VolumePath(name, "/"+filepath.ToSlash(rel))
+}
+
+// LocalPath returns the local path of a stored file,
+// ok is false for files on volumes that aren't mounted
+func (v *Volumes) LocalPath(path string) (string, bool) {
+	name, volumePath, onVolume := file.SplitVolumePath(path)
+	if !onVolume {
+		return path, true
+	}
+	root, ok := v.Mounted(name)
+	if !ok {
+		return "", false
+	}
+	return filepath.Join(root, filepath.FromSlash(volumePath)), true
+}
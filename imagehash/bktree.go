@@ -0,0 +1,73 @@
+package imagehash
+
+// BKTree indexes hashes by Hamming distance for fast similarity searches
+type BKTree struct {
+	root *bkNode
+}
+
+type bkNode struct {
+	hash     uint64
+	items    []string
+	children map[int]*bkNode
+}
+
+// Match is an item found within the searched distance
+type Match struct {
+	Item     string
+	Hash     uint64
+	Distance int
+}
+
+// Add adds an item with the given hash to the tree
+func (t *BKTree) Add(hash uint64, item string) {
+	if t.root == nil {
+		t.root = &bkNode{hash: hash, items: []string{item}, children: map[int]*bkNode{}}
+		return
+	}
+
+	node := t.root
+	for {
+		d := Distance(node.hash, hash)
+		if d == 0 {
+			node.items = append(node.items, item)
+			return
+		}
+
+		child, ok := node.children[d]
+		if !ok {
+			node.children[d] = &bkNode{hash: hash, items: []string{item}, children: map[int]*bkNode{}}
+			return
+		}
+		node = child
+	}
+}
+
+// Search returns all items whose hash is at most max bits away from hash
+func (t *BKTree) Search(hash uint64, max int) []Match {
+	var matches []Match
+	if t.root == nil {
+		return matches
+	}
+
+	stack := []*bkNode{t.root}
+	for len(stack) > 0 {
+		node := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		d := Distance(node.hash, hash)
+		if d <= max {
+			for _, item := range node.items {
+				matches = append(matches, Match{Item: item, Hash: node.hash, Distance: d})
+			}
+		}
+
+		// By the triangle inequality only children in this range can match
+		for cd, child := range node.children {
+			if cd >= d-max && cd <= d+max {
+				stack = append(stack, child)
+			}
+		}
+	}
+
+	return matches
+}
@@ -0,0 +1,69 @@
+package imagehash
+
+import (
+	"math/rand"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+func TestBKTreeSearch(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+
+	var tree BKTree
+	hashes := make([]uint64, 500)
+	for i := range hashes {
+		// Flip a few bits of a common base so there are matches at every distance
+		hashes[i] = 0xf0f0f0f0f0f0f0f0 ^ rng.Uint64()&rng.Uint64()&rng.Uint64()
+		tree.Add(hashes[i], strconv.Itoa(i))
+	}
+	// Same hash twice
+	tree.Add(hashes[0], "copy")
+
+	for _, max := range []int{0, 3, 8, 16} {
+		query := hashes[rng.Intn(len(hashes))]
+		matches := tree.Search(query, max)
+
+		want := 0
+		for _, h := range hashes {
+			if Distance(h, query) <= max {
+				want++
+			}
+		}
+		if Distance(hashes[0], query) <= max {
+			want++
+		}
+		if len(matches) != want {
+			t.Errorf("max %d: got %d matches, want %d", max, len(matches), want)
+		}
+		for _, m := range matches {
+			if m.Distance != Distance(m.Hash, query) || m.Distance > max {
+				t.Errorf("max %d: bad match %+v", max, m)
+			}
+		}
+	}
+}
+
+func TestBKTreeEmpty(t *testing.T) {
+	var tree BKTree
+	if matches := tree.Search(0, 64); len(matches) != 0 {
+		t.Errorf("got %d matches in an empty tree", len(matches))
+	}
+}
+
+func TestBKTreeItems(t *testing.T) {
+	var tree BKTree
+	tree.Add(0b0000, "a")
+	tree.Add(0b0001, "b")
+	tree.Add(0b0011, "c")
+	tree.Add(0b0000, "d")
+
+	var items []string
+	for _, m := range tree.Search(0, 1) {
+		items = append(items, m.Item)
+	}
+	sort.Strings(items)
+	if len(items) != 3 || items[0] != "a" || items[1] != "b" || items[2] != "d" {
+		t.Errorf("got %v, want [a b d]", items)
+	}
+}
@@ -0,0 +1,162 @@
+package imagehash
+
+import (
+	"fmt"
+	"image"
+	"io"
+	"math"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	// Register decoders for the supported formats
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+)
+
+// Extensions of the image files that can be hashed
+var extensions = map[string]bool{
+	".jpg":  true,
+	".jpeg": true,
+	".png":  true,
+	".gif":  true,
+}
+
+// IsImage returns true if the file looks like a supported image based on its extension
+func IsImage(path string) bool {
+	return extensions[strings.ToLower(filepath.Ext(path))]
+}
+
+// HashFile decodes an image file and returns its pHash and dHash
+func HashFile(path string) (uint64, uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	return Hash(f)
+}
+
+// Hash decodes an image and returns its pHash and dHash
+func Hash(r io.Reader) (uint64, uint64, error) {
+	img, _, err := image.Decode(r)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return PHash(img), DHash(img), nil
+}
+
+// DHash computes a difference hash: each bit tells if a pixel is brighter
+// than its right neighbour in a 9x8 grayscale version of the image
+func DHash(img image.Image) uint64 {
+	const w, h = 9, 8
+	pixels := grayscale(img, w, h)
+
+	var hash uint64
+	for y := 0; y < h; y++ {
+		for x := 0; x < w-1; x++ {
+			hash <<= 1
+			if pixels[y*w+x] > pixels[y*w+x+1] {
+				hash |= 1
+			}
+		}
+	}
+
+	return hash
+}
+
+// PHash computes a perceptual hash: each bit tells if a low frequency DCT
+// coefficient of a 32x32 grayscale version of the image is above the median
+func PHash(img image.Image) uint64 {
+	const size, low = 32, 8
+	pixels := grayscale(img, size, size)
+
+	// Only the low frequencies are needed, compute them separably
+	rows := make([]float64, size*low)
+	for y := 0; y < size; y++ {
+		for u := 0; u < low; u++ {
+			var sum float64
+			for x := 0; x < size; x++ {
+				sum += pixels[y*size+x] * dctCos(x, u, size)
+			}
+			rows[y*low+u] = sum
+		}
+	}
+
+	coeffs := make([]float64, low*low)
+	for v := 0; v < low; v++ {
+		for u := 0; u < low; u++ {
+			var sum float64
+			for y := 0; y < size; y++ {
+				sum += rows[y*low+u] * dctCos(y, v, size)
+			}
+			coeffs[v*low+u] = sum
+		}
+	}
+
+	// The DC term is the average brightness, leave it out of the median
+	sorted := append([]float64{}, coeffs[1:]...)
+	sort.Float64s(sorted)
+	median := sorted[len(sorted)/2]
+
+	var hash uint64
+	for _, c := range coeffs {
+		hash <<= 1
+		if c > median {
+			hash |= 1
+		}
+	}
+
+	return hash
+}
+
+func dctCos(x, u, n int) float64 {
+	return math.Cos(float64(2*x+1) * float64(u) * math.Pi / float64(2*n))
+}
+
+// grayscale scales the image to w x h by averaging the pixels in each cell
+// and returns the luminance values row by row
+func grayscale(img image.Image, w, h int) []float64 {
+	bounds := img.Bounds()
+	sums := make([]float64, w*h)
+	counts := make([]float64, w*h)
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		cy := (y - bounds.Min.Y) * h / bounds.Dy()
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			cx := (x - bounds.Min.X) * w / bounds.Dx()
+			r, g, b, _ := img.At(x, y).RGBA()
+			sums[cy*w+cx] += 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)
+			counts[cy*w+cx]++
+		}
+	}
+
+	for i := range sums {
+		if counts[i] > 0 {
+			sums[i] /= counts[i]
+		}
+	}
+
+	return sums
+}
+
+// Distance returns the Hamming distance of two hashes
+func Distance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// Format returns the hash as a hex string for storing
+func Format(hash uint64) string {
+	return fmt.Sprintf("%016x", hash)
+}
+
+// Parse parses a hash stored with Format
+func Parse(s string) (uint64, error) {
+	return strconv.ParseUint(s, 16, 64)
+}
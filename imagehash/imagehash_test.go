@@ -0,0 +1,103 @@
+package imagehash
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// gradient returns a test image with a diagonal gradient and a bright square
+func gradient(w, h int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			v := uint8((x + y) * 255 / (w + h))
+			if x > w/2 && y > h/2 {
+				v = 255 - v/4
+			}
+			img.Set(x, y, color.RGBA{v, v, v, 255})
+		}
+	}
+	return img
+}
+
+// mirror returns the image flipped horizontally
+func mirror(img image.Image) image.Image {
+	b := img.Bounds()
+	out := image.NewRGBA(b)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			out.Set(b.Max.X-1-x+b.Min.X, y, img.At(x, y))
+		}
+	}
+	return out
+}
+
+func TestSimilarImages(t *testing.T) {
+	img := gradient(256, 192)
+
+	var pngBuf, jpegBuf bytes.Buffer
+	if err := png.Encode(&pngBuf, img); err != nil {
+		t.Fatal(err)
+	}
+	if err := jpeg.Encode(&jpegBuf, gradient(128, 96), &jpeg.Options{Quality: 60}); err != nil {
+		t.Fatal(err)
+	}
+
+	p1, d1, err := Hash(&pngBuf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Scaled down and recompressed
+	p2, d2, err := Hash(&jpegBuf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := Distance(p1, p2); d > 10 {
+		t.Errorf("pHash distance of a resized copy is %d", d)
+	}
+	if d := Distance(d1, d2); d > 10 {
+		t.Errorf("dHash distance of a resized copy is %d", d)
+	}
+
+	p3, d3 := PHash(mirror(img)), DHash(mirror(img))
+	if d := Distance(p1, p3); d <= 10 {
+		t.Errorf("pHash distance of a mirrored image is only %d", d)
+	}
+	if d := Distance(d1, d3); d <= 10 {
+		t.Errorf("dHash distance of a mirrored image is only %d", d)
+	}
+}
+
+func TestFormatParse(t *testing.T) {
+	for _, hash := range []uint64{0, 1, 0xdeadbeef, ^uint64(0)} {
+		s := Format(hash)
+		if len(s) != 16 {
+			t.Errorf("Format(%x) = %q, want 16 characters", hash, s)
+		}
+		got, err := Parse(s)
+		if err != nil || got != hash {
+			t.Errorf("Parse(%q) = %x, %v, want %x", s, got, err, hash)
+		}
+	}
+}
+
+func TestIsImage(t *testing.T) {
+	for path, want := range map[string]bool{
+		"a.jpg":       true,
+		"b.JPEG":      true,
+		"dir/c.png":   true,
+		"d.gif":       true,
+		"e.tiff":      false,
+		"png":         false,
+		"f.png.txt":   false,
+		"archive.zip": false,
+	} {
+		if got := IsImage(path); got != want {
+			t.Errorf("IsImage(%q) = %v, want %v", path, got, want)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+// Package metrics exposes the progress of scans and watches in the
+// Prometheus text format
+package metrics
+
+import (
+	"io"
+	"net"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// FilesHashed is the amount of files whose contents have been hashed
+	FilesHashed = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "godupe_files_hashed_total",
+		Help: "Files whose contents have been hashed.",
+	})
+	// FilesSkipped is the amount of files that didn't need to be read
+	FilesSkipped = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "godupe_files_skipped_total",
+		Help: "Files already in the DB or with a hash known without reading them.",
+	})
+	// BytesRead is the amount of bytes read for hashing
+	BytesRead = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "godupe_bytes_read_total",
+		Help: "Bytes read for hashing.",
+	})
+	// HashDuration is the time spent hashing each file. The hash throughput is
+	// rate(godupe_bytes_read_total) / rate(godupe_hash_duration_seconds_sum)
+	HashDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "godupe_hash_duration_seconds",
+		Help:    "Time spent hashing a file.",
+		Buckets: prometheus.ExponentialBuckets(0.001, 4, 10),
+	})
+	// DBWriteDuration is the latency of writes to the DB by operation
+	DBWriteDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "godupe_db_write_duration_seconds",
+		Help:    "Latency of DB writes.",
+		Buckets: prometheus.ExponentialBuckets(0.0001, 4, 10),
+	}, []string{"op"})
+	// Errors is the amount of files and directories that couldn't be processed, by operation
+	Errors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "godupe_errors_total",
+		Help: "Files and directories that couldn't be processed.",
+	}, []string{"op"})
+	// QueueDepth is the amount of changed files waiting to be hashed by watch
+	QueueDepth = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "godupe_queue_depth",
+		Help: "Changed files waiting to be hashed.",
+	})
+)
+
+// registry holds the godupe metrics and the runtime metrics of the process
+var registry = prometheus.NewRegistry()
+
+func init() {
+	registry.MustRegister(FilesHashed, FilesSkipped, BytesRead, HashDuration, DBWriteDuration, Errors, QueueDepth)
+	registry.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+}
+
+// DBWrite starts timing a DB write, call ObserveDuration when it's done
+func DBWrite(op string) *prometheus.Timer {
+	return prometheus.NewTimer(DBWriteDuration.WithLabelValues(op))
+}
+
+// Error counts a failed operation
+func Error(op string) {
+	Errors.WithLabelValues(op).Inc()
+}
+
+// Value returns the current value of a counter
+func Value(c prometheus.Counter) float64 {
+	var m dto.Metric
+	if err := c.Write(&m); err != nil {
+		return 0
+	}
+	return m.GetCounter().GetValue()
+}
+
+// bytesWriter counts the bytes written to it as read
+type bytesWriter struct{}
+
+func (bytesWriter) Write(p []byte) (int, error) {
+	BytesRead.Add(float64(len(p)))
+	return len(p), nil
+}
+
+// CountBytes returns a writer that counts the bytes written to it in
+// BytesRead and passes them on to w, if given
+func CountBytes(w io.Writer) io.Writer {
+	if w == nil {
+		return bytesWriter{}
+	}
+	return io.MultiWriter(w, bytesWriter{})
+}
+
+// Listen serves the metrics at /metrics on addr in the background
+func Listen(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+
+	log.Infof("Serving metrics at http://%s/metrics", l.Addr())
+	go func() {
+		if err := http.Serve(l, mux); err != nil {
+			log.Errorf("Error serving metrics: %s", err)
+		}
+	}()
+	return nil
+}
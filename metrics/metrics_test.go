@@ -0,0 +1,70 @@
+package metrics
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestCountBytes(t *testing.T) {
+	before := Value(BytesRead)
+
+	var buf bytes.Buffer
+	if _, err := io.WriteString(CountBytes(&buf), "hello"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.WriteString(CountBytes(nil), "world!"); err != nil {
+		t.Fatal(err)
+	}
+
+	if buf.String() != "hello" {
+		t.Errorf("passed on %q, want hello", buf.String())
+	}
+	if n := Value(BytesRead) - before; n != 11 {
+		t.Errorf("counted %v bytes, want 11", n)
+	}
+}
+
+func TestListen(t *testing.T) {
+	// Find a free port
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	if err := Listen(addr); err != nil {
+		t.Fatal(err)
+	}
+	if err := Listen(addr); err == nil {
+		t.Error("Listen on an address in use succeeded")
+	}
+
+	Error("test")
+	DBWrite("test").ObserveDuration()
+
+	resp, err := http.Get("http://" + addr + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{
+		"godupe_files_hashed_total",
+		`godupe_errors_total{op="test"} 1`,
+		`godupe_db_write_duration_seconds_count{op="test"} 1`,
+		"go_goroutines",
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("metrics don't have %s", want)
+		}
+	}
+}
@@ -0,0 +1,366 @@
+package progress
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/term"
+)
+
+// How often the progress line is redrawn on a terminal
+const ttyInterval = 250 * time.Millisecond
+
+// How often a progress line is logged when not on a terminal
+const plainInterval = 10 * time.Second
+
+// totals holds file and byte counts for a single directory
+type totals struct {
+	files int64
+	bytes int64
+}
+
+// Reporter tracks aggregate progress for a whole walk.
+// A nil *Reporter is valid and reports nothing.
+type Reporter struct {
+	mu sync.Mutex
+
+	out   io.Writer
+	tty   bool
+	width int
+
+	// discovered by the pre-count pass, per directory and in total
+	dirs       map[string]totals
+	total      totals
+	counted    bool
+	skippedDir map[string]bool
+
+	// files and bytes processed so far, skipped files included
+	done totals
+	// bytes of files that have been actually hashed, used for the ETA
+	workBytes int64
+	// bytes read by the hasher, used for throughput
+	readBytes int64
+	// bytes of the current file read so far
+	fileRead int64
+	current  string
+
+	start time.Time
+	stop  chan struct{}
+	wg    sync.WaitGroup
+}
+
+// New creates a reporter writing to out. If out is not a terminal, progress
+// is logged periodically instead of being drawn on a single line.
+func New(out *os.File) *Reporter {
+	r := &Reporter{
+		out:        out,
+		dirs:       map[string]totals{},
+		skippedDir: map[string]bool{},
+		width:      80,
+	}
+
+	fd := int(out.Fd())
+	if term.IsTerminal(fd) {
+		r.tty = true
+		if w, _, err := term.GetSize(fd); err == nil && w > 0 {
+			r.width = w
+		}
+	}
+
+	return r
+}
+
+// Count walks the given tree and records the amount of files and bytes in it,
+// the totals are used to calculate the ETA
+func (r *Reporter) Count(root string) error {
+	if r == nil {
+		return nil
+	}
+
+	absroot, err := filepath.Abs(root)
+	if err != nil {
+		return err
+	}
+
+	err = filepath.WalkDir(absroot, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// Unreadable parts of the tree are reported by the actual scan
+			if d != nil && d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+
+		dir := filepath.Dir(path)
+
+		r.mu.Lock()
+		t := r.dirs[dir]
+		t.files++
+		t.bytes += info.Size()
+		r.dirs[dir] = t
+		r.total.files++
+		r.total.bytes += info.Size()
+		r.mu.Unlock()
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.counted = true
+	r.mu.Unlock()
+
+	log.Infof("Found %d files, %s", r.total.files, FormatBytes(r.total.bytes))
+
+	return nil
+}
+
+// Start begins periodic reporting
+func (r *Reporter) Start() {
+	if r == nil {
+		return
+	}
+
+	r.start = time.Now()
+	r.stop = make(chan struct{})
+
+	interval := plainInterval
+	if r.tty {
+		interval = ttyInterval
+	}
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				r.report()
+			case <-r.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Finish stops periodic reporting and prints a summary
+func (r *Reporter) Finish() {
+	if r == nil || r.stop == nil {
+		return
+	}
+
+	close(r.stop)
+	r.wg.Wait()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.tty {
+		fmt.Fprint(r.out, "\r\033[K")
+	}
+
+	elapsed := time.Since(r.start)
+	log.Infof("Processed %d files, %s in %s (%s/s)",
+		r.done.files, FormatBytes(r.done.bytes), elapsed.Round(time.Second), FormatBytes(rate(r.readBytes, elapsed)))
+}
+
+// StartFile marks the given file as the one currently being hashed
+func (r *Reporter) StartFile(path string) {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.current = path
+	r.fileRead = 0
+}
+
+// Write counts bytes read by the hasher, so the reporter can be used as an io.Writer
+func (r *Reporter) Write(p []byte) (int, error) {
+	if r == nil {
+		return len(p), nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.readBytes += int64(len(p))
+	r.fileRead += int64(len(p))
+
+	return len(p), nil
+}
+
+// FileDone marks the current file as hashed
+func (r *Reporter) FileDone(size int64) {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.done.files++
+	r.done.bytes += size
+	r.workBytes += size
+	r.fileRead = 0
+	r.current = ""
+}
+
+// Skip marks a single file as processed without hashing it
+func (r *Reporter) Skip(size int64) {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.done.files++
+	r.done.bytes += size
+}
+
+// SkipDir marks all files in the given directory tree as processed
+func (r *Reporter) SkipDir(dir string) {
+	if r == nil {
+		return
+	}
+
+	absdir, err := filepath.Abs(dir)
+	if err != nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	prefix := absdir + string(filepath.Separator)
+	for path, t := range r.dirs {
+		if path != absdir && !strings.HasPrefix(path, prefix) {
+			continue
+		}
+		// directories can be reported more than once if scan skips a parent
+		if r.skippedDir[path] {
+			continue
+		}
+		r.skippedDir[path] = true
+		r.done.files += t.files
+		r.done.bytes += t.bytes
+	}
+}
+
+// report draws or logs the current progress
+func (r *Reporter) report() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	elapsed := time.Since(r.start)
+	line := r.status(elapsed)
+
+	if !r.tty {
+		if r.current != "" {
+			line += " - " + r.current
+		}
+		log.Info(line)
+		return
+	}
+
+	if r.current != "" {
+		// leave room for the separator
+		room := r.width - len(line) - 4
+		if room > 10 {
+			line += " - " + truncate(r.current, room)
+		}
+	}
+	if len(line) >= r.width {
+		line = line[:r.width-1]
+	}
+
+	fmt.Fprint(r.out, "\r\033[K"+line)
+}
+
+// status formats counts, throughput and ETA
+func (r *Reporter) status(elapsed time.Duration) string {
+	// bytes of the file being hashed count toward the progress
+	doneBytes := r.done.bytes + r.fileRead
+
+	if !r.counted {
+		return fmt.Sprintf("%d files, %s, %s/s",
+			r.done.files, FormatBytes(doneBytes), FormatBytes(rate(r.readBytes, elapsed)))
+	}
+
+	return fmt.Sprintf("%d/%d files, %s/%s, %s/s, ETA %s",
+		r.done.files, r.total.files,
+		FormatBytes(doneBytes), FormatBytes(r.total.bytes),
+		FormatBytes(rate(r.readBytes, elapsed)),
+		r.eta(elapsed, doneBytes))
+}
+
+// eta estimates the remaining time from the rate of hashed (not skipped) bytes
+func (r *Reporter) eta(elapsed time.Duration, doneBytes int64) string {
+	work := r.workBytes + r.fileRead
+	if work == 0 || elapsed <= 0 {
+		return "-"
+	}
+
+	remaining := r.total.bytes - doneBytes
+	if remaining <= 0 {
+		return "0s"
+	}
+
+	perSecond := float64(work) / elapsed.Seconds()
+	left := time.Duration(float64(remaining)/perSecond) * time.Second
+
+	return left.Round(time.Second).String()
+}
+
+// rate returns n per second over the given duration
+func rate(n int64, elapsed time.Duration) int64 {
+	if elapsed <= 0 {
+		return 0
+	}
+	return int64(float64(n) / elapsed.Seconds())
+}
+
+// truncate shortens a path from the left to fit in n characters
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return "..." + s[len(s)-n+3:]
+}
+
+// FormatBytes returns a human readable version of a byte count
+func FormatBytes(b int64) string {
+	const unit = 1024
+	if b < unit {
+		return fmt.Sprintf("%d B", b)
+	}
+	div, exp := int64(unit), 0
+	for n := b / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(b)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,38 @@
+package remote
+
+import (
+	"io"
+	"io/fs"
+)
+
+// dirList implements ReadDir of fs.ReadDirFile for the remote file systems,
+// the directory is listed on the first call
+type dirList struct {
+	list    func() ([]fs.DirEntry, error)
+	entries []fs.DirEntry
+	listed  bool
+}
+
+// ReadDir returns the next n entries of the directory, all remaining entries if n <= 0
+func (d *dirList) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !d.listed {
+		entries, err := d.list()
+		if err != nil {
+			return nil, err
+		}
+		d.entries, d.listed = entries, true
+	}
+
+	if n <= 0 {
+		entries := d.entries
+		d.entries = nil
+		return entries, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	n = min(n, len(d.entries))
+	entries := d.entries[:n]
+	d.entries = d.entries[n:]
+	return entries, nil
+}
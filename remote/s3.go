@@ -0,0 +1,281 @@
+package remote
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	log "github.com/sirupsen/logrus"
+)
+
+// S3Options configures connections to S3 compatible object storage
+type S3Options struct {
+	// Endpoint is the host[:port] or URL of the service, AWS_ENDPOINT_URL or
+	// s3.amazonaws.com if not set. http:// URLs use plain HTTP, e.g. for a local MinIO
+	Endpoint string
+}
+
+// S3 is a bucket in S3 compatible object storage
+type S3 struct {
+	client *minio.Client
+	bucket string
+	prefix string
+}
+
+// md5ETag matches ETags that are the MD5 of the object, multipart uploads have a -N suffix
+var md5ETag = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// IsS3 returns true if path is an s3:// URL
+func IsS3(path string) bool {
+	return strings.HasPrefix(path, "s3://")
+}
+
+// OpenS3 connects to the bucket of an s3://bucket/prefix URL. Credentials are
+// read from the AWS_ or MINIO_ environment variables or ~/.aws/credentials,
+// without credentials the bucket is accessed anonymously.
+func OpenS3(rawURL string, opts S3Options) (*S3, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "s3" || u.Host == "" {
+		return nil, fmt.Errorf("not an s3://bucket/prefix URL: %s", rawURL)
+	}
+
+	endpoint := opts.Endpoint
+	if endpoint == "" {
+		endpoint = os.Getenv("AWS_ENDPOINT_URL")
+	}
+	if endpoint == "" {
+		endpoint = "s3.amazonaws.com"
+	}
+	secure := true
+	if e, err := url.Parse(endpoint); err == nil && e.Host != "" {
+		secure = e.Scheme != "http"
+		endpoint = e.Host
+	}
+
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds: credentials.NewChainCredentials([]credentials.Provider{
+			&credentials.EnvAWS{},
+			&credentials.EnvMinio{},
+			&credentials.FileAWSCredentials{},
+		}),
+		Secure: secure,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	exists, err := client.BucketExists(context.Background(), u.Host)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("bucket %s doesn't exist", u.Host)
+	}
+
+	prefix := strings.Trim(path.Clean("/"+u.Path), "/")
+	return &S3{client: client, bucket: u.Host, prefix: prefix}, nil
+}
+
+// Bucket returns the name of the bucket
+func (c *S3) Bucket() string {
+	return c.bucket
+}
+
+// Dir returns the prefix given in the URL as a path in FS, "." for the whole bucket
+func (c *S3) Dir() string {
+	if c.prefix == "" {
+		return "."
+	}
+	return c.prefix
+}
+
+// FS returns the objects of the bucket as a file system. Names are
+// the object keys, prefixes ending with a slash are directories.
+func (c *S3) FS() fs.FS {
+	return s3FS{client: c.client, bucket: c.bucket}
+}
+
+// s3FS is the file system of a bucket
+type s3FS struct {
+	client *minio.Client
+	bucket string
+}
+
+// objectInfo describes an object or a prefix
+type objectInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	dir     bool
+}
+
+func (i objectInfo) Name() string       { return path.Base(i.name) }
+func (i objectInfo) Size() int64        { return i.size }
+func (i objectInfo) ModTime() time.Time { return i.modTime }
+func (i objectInfo) IsDir() bool        { return i.dir }
+func (i objectInfo) Sys() interface{}   { return nil }
+
+func (i objectInfo) Mode() fs.FileMode {
+	if i.dir {
+		return fs.ModeDir | 0555
+	}
+	return 0444
+}
+
+// s3File is an open object
+type s3File struct {
+	*minio.Object
+	info objectInfo
+}
+
+func (f *s3File) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+// s3Dir is an open prefix
+type s3Dir struct {
+	info objectInfo
+	dirList
+}
+
+func (d *s3Dir) Stat() (fs.FileInfo, error) { return d.info, nil }
+func (d *s3Dir) Close() error               { return nil }
+
+func (d *s3Dir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.name, Err: fs.ErrInvalid}
+}
+
+func (f s3FS) Open(name string) (fs.File, error) {
+	info, err := f.stat("open", name)
+	if err != nil {
+		return nil, err
+	}
+	if info.dir {
+		list := func() ([]fs.DirEntry, error) { return f.ReadDir(name) }
+		return &s3Dir{info: info, dirList: dirList{list: list}}, nil
+	}
+
+	obj, err := f.client.GetObject(context.Background(), f.bucket, name, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return &s3File{Object: obj, info: info}, nil
+}
+
+func (f s3FS) Stat(name string) (fs.FileInfo, error) {
+	return f.stat("stat", name)
+}
+
+// stat returns the info of an object, or of a prefix if there's no object with the name
+func (f s3FS) stat(op, name string) (objectInfo, error) {
+	if !fs.ValidPath(name) {
+		return objectInfo{}, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	if name == "." {
+		return objectInfo{name: name, dir: true}, nil
+	}
+
+	obj, err := f.client.StatObject(context.Background(), f.bucket, name, minio.StatObjectOptions{})
+	if err == nil {
+		return objectInfo{name: name, size: obj.Size, modTime: obj.LastModified}, nil
+	}
+	if minio.ToErrorResponse(err).Code != "NoSuchKey" {
+		return objectInfo{}, &fs.PathError{Op: op, Path: name, Err: err}
+	}
+
+	// Prefixes exist as long as there are objects under them
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	for obj := range f.client.ListObjects(ctx, f.bucket, minio.ListObjectsOptions{Prefix: name + "/", MaxKeys: 1}) {
+		if obj.Err != nil {
+			return objectInfo{}, &fs.PathError{Op: op, Path: name, Err: obj.Err}
+		}
+		return objectInfo{name: name, dir: true}, nil
+	}
+	return objectInfo{}, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+}
+
+func (f s3FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	prefix := ""
+	if name != "." {
+		prefix = name + "/"
+	}
+
+	entries := []fs.DirEntry{}
+	for obj := range f.client.ListObjects(context.Background(), f.bucket, minio.ListObjectsOptions{Prefix: prefix}) {
+		if obj.Err != nil {
+			return nil, &fs.PathError{Op: "readdir", Path: name, Err: obj.Err}
+		}
+
+		// Sub prefixes are listed with a trailing slash
+		rel := strings.TrimPrefix(obj.Key, prefix)
+		dir := strings.HasSuffix(rel, "/")
+		rel = strings.TrimSuffix(rel, "/")
+
+		// Skip the directory marker of the prefix itself
+		if rel == "" {
+			continue
+		}
+		// Keys like a//b or ./a can't be file names
+		if strings.Contains(rel, "/") || !fs.ValidPath(rel) {
+			log.Warnf("Skipping object with an unsupported key: %s", obj.Key)
+			continue
+		}
+
+		info := objectInfo{name: path.Join(name, rel), size: obj.Size, modTime: obj.LastModified, dir: dir}
+		entries = append(entries, fs.FileInfoToDirEntry(info))
+	}
+	if len(entries) == 0 && name != "." {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+// Digests returns the SHA-256 checksum of an object if it was uploaded with
+// one, and the MD5 if the ETag is one. ETags of multipart uploads and objects
+// encrypted with SSE-KMS or SSE-C aren't MD5s of the contents.
+func (f s3FS) Digests(name string) (string, string, error) {
+	if !fs.ValidPath(name) {
+		return "", "", &fs.PathError{Op: "digests", Path: name, Err: fs.ErrInvalid}
+	}
+
+	obj, err := f.client.StatObject(context.Background(), f.bucket, name, minio.StatObjectOptions{Checksum: true})
+	if err != nil {
+		return "", "", &fs.PathError{Op: "digests", Path: name, Err: err}
+	}
+
+	var sum string
+	// Checksums of multipart uploads are checksums of the part checksums, with a -N suffix
+	if raw, err := base64.StdEncoding.DecodeString(obj.ChecksumSHA256); err == nil && len(raw) == 32 {
+		sum = hex.EncodeToString(raw)
+	}
+
+	var md5 string
+	etag := strings.ToLower(strings.Trim(obj.ETag, `"`))
+	encrypted := obj.Metadata.Get("X-Amz-Server-Side-Encryption") == "aws:kms" ||
+		obj.Metadata.Get("X-Amz-Server-Side-Encryption-Customer-Algorithm") != ""
+	if md5ETag.MatchString(etag) && !encrypted {
+		md5 = etag
+	}
+
+	return sum, md5, nil
+}
@@ -0,0 +1,105 @@
+package remote
+
+import (
+	"context"
+	"crypto/md5"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// openTestS3 opens the bucket in GODUPE_TEST_S3, e.g. s3://test/godupe on a
+// local MinIO given with AWS_ENDPOINT_URL. The bucket must exist.
+func openTestS3(t *testing.T) *S3 {
+	rawURL := os.Getenv("GODUPE_TEST_S3")
+	if rawURL == "" {
+		t.Skip("GODUPE_TEST_S3 not set")
+	}
+	c, err := OpenS3(rawURL, S3Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestS3FS(t *testing.T) {
+	c := openTestS3(t)
+
+	files := map[string]string{
+		"a.txt":         "hello",
+		"dir/b.txt":     "world",
+		"dir/sub/c.txt": strings.Repeat("c", 10000),
+	}
+	for name, data := range files {
+		key := c.prefix + "/" + name
+		_, err := c.client.PutObject(context.Background(), c.bucket, key, strings.NewReader(data), int64(len(data)), minio.PutObjectOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			c.client.RemoveObject(context.Background(), c.bucket, key, minio.RemoveObjectOptions{})
+		})
+	}
+
+	// fstest.TestFS can't be used, minio objects can't seek backwards from
+	// the end and listings have more precise times than stats
+	got := map[string]string{}
+	err := fs.WalkDir(c.FS(), c.Dir(), func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := fs.ReadFile(c.FS(), name)
+		if err != nil {
+			return err
+		}
+		got[strings.TrimPrefix(name, c.Dir()+"/")] = string(data)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, files) {
+		t.Errorf("walked %v, want %v", got, files)
+	}
+
+	// Opened prefixes can be listed too
+	f, err := c.FS().Open(c.Dir() + "/dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	dir, ok := f.(fs.ReadDirFile)
+	if !ok {
+		t.Fatalf("opened prefix is a %T, not a fs.ReadDirFile", f)
+	}
+	var names []string
+	for {
+		entries, err := dir.ReadDir(1)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, entries[0].Name())
+	}
+	if want := []string{"b.txt", "sub"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("listed %v, want %v", names, want)
+	}
+
+	// Single part uploads have the MD5 as their ETag
+	fsys := c.FS().(s3FS)
+	_, sum, err := fsys.Digests(c.Dir() + "/a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := fmt.Sprintf("%x", md5.Sum([]byte("hello"))); sum != want {
+		t.Errorf("MD5 of a.txt = %q, want %q", sum, want)
+	}
+}
@@ -0,0 +1,245 @@
+// Package remote gives access to files on other machines as an fs.FS
+package remote
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/url"
+	"os"
+	"os/user"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/sftp"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// SSHOptions configures SSH connections
+type SSHOptions struct {
+	// KeyFile is a private key tried after the SSH agent and the default keys in ~/.ssh
+	KeyFile string
+	// KnownHosts is the file the host keys are verified against, ~/.ssh/known_hosts if not set
+	KnownHosts string
+}
+
+// SFTP is a connection to a remote host over SFTP
+type SFTP struct {
+	ssh    *ssh.Client
+	client *sftp.Client
+	host   string
+	dir    string
+}
+
+// IsSFTP returns true if path is an sftp:// URL
+func IsSFTP(path string) bool {
+	return strings.HasPrefix(path, "sftp://")
+}
+
+// DialSFTP connects to the host of an sftp://[user@]host[:port]/path URL
+func DialSFTP(rawURL string, opts SSHOptions) (*SFTP, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "sftp" || u.Hostname() == "" {
+		return nil, fmt.Errorf("not an sftp://host/path URL: %s", rawURL)
+	}
+
+	config, err := sshConfig(u, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	port := u.Port()
+	if port == "" {
+		port = "22"
+	}
+	conn, err := ssh.Dial("tcp", net.JoinHostPort(u.Hostname(), port), config)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	dir := path.Clean("/" + u.Path)
+	return &SFTP{ssh: conn, client: client, host: u.Hostname(), dir: dir}, nil
+}
+
+// sshConfig returns the client configuration for the user and host in the URL
+func sshConfig(u *url.URL, opts SSHOptions) (*ssh.ClientConfig, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+
+	username := u.User.Username()
+	if username == "" {
+		current, err := user.Current()
+		if err != nil {
+			return nil, err
+		}
+		username = current.Username
+	}
+
+	knownHostsFile := opts.KnownHosts
+	if knownHostsFile == "" {
+		knownHostsFile = filepath.Join(home, ".ssh", "known_hosts")
+	}
+	hostKeyCallback, err := knownhosts.New(knownHostsFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading known hosts: %w", err)
+	}
+
+	var signers []ssh.Signer
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		if conn, err := net.Dial("unix", sock); err == nil {
+			agentSigners, err := agent.NewClient(conn).Signers()
+			if err != nil {
+				log.Debugf("Error listing SSH agent keys: %s", err)
+			}
+			signers = append(signers, agentSigners...)
+		}
+	}
+
+	keyFiles := []string{
+		filepath.Join(home, ".ssh", "id_ed25519"),
+		filepath.Join(home, ".ssh", "id_ecdsa"),
+		filepath.Join(home, ".ssh", "id_rsa"),
+	}
+	if opts.KeyFile != "" {
+		keyFiles = append(keyFiles, opts.KeyFile)
+	}
+	for _, keyFile := range keyFiles {
+		data, err := os.ReadFile(keyFile)
+		if err != nil {
+			if keyFile == opts.KeyFile {
+				return nil, err
+			}
+			continue
+		}
+		signer, err := ssh.ParsePrivateKey(data)
+		if err != nil {
+			// Keys with passphrases are used through the agent
+			log.Debugf("Skipping SSH key %s: %s", keyFile, err)
+			continue
+		}
+		signers = append(signers, signer)
+	}
+
+	return &ssh.ClientConfig{
+		User:            username,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signers...)},
+		HostKeyCallback: hostKeyCallback,
+	}, nil
+}
+
+// Host returns the name of the remote host
+func (c *SFTP) Host() string {
+	return c.host
+}
+
+// Dir returns the directory given in the URL as a path in FS, "." for the root
+func (c *SFTP) Dir() string {
+	if c.dir == "/" {
+		return "."
+	}
+	return strings.TrimPrefix(c.dir, "/")
+}
+
+// FS returns the remote file system. Names are the remote paths without
+// the leading slash, e.g. home/user/img.jpg
+func (c *SFTP) FS() fs.FS {
+	return sftpFS{client: c.client}
+}
+
+// Close closes the connection
+func (c *SFTP) Close() error {
+	return errors.Join(c.client.Close(), c.ssh.Close())
+}
+
+// sftpFS is the file system of the remote host
+type sftpFS struct {
+	client *sftp.Client
+}
+
+// remotePath returns the remote path of a name in the file system
+func remotePath(op, name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	return path.Join("/", name), nil
+}
+
+func (f sftpFS) Open(name string) (fs.File, error) {
+	p, err := remotePath("open", name)
+	if err != nil {
+		return nil, err
+	}
+	file, err := f.client.Open(p)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	list := func() ([]fs.DirEntry, error) { return f.ReadDir(name) }
+	return &sftpFile{File: file, dirList: dirList{list: list}}, nil
+}
+
+// sftpFile is an open remote file or directory. Like with os.File,
+// ReadDir fails for anything but directories.
+type sftpFile struct {
+	*sftp.File
+	dirList
+}
+
+func (f sftpFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	p, err := remotePath("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	infos, err := f.client.ReadDir(p)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+
+	entries := make([]fs.DirEntry, len(infos))
+	for i, info := range infos {
+		entries[i] = fs.FileInfoToDirEntry(info)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+func (f sftpFS) Stat(name string) (fs.FileInfo, error) {
+	p, err := remotePath("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.client.Stat(p)
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+	return info, nil
+}
+
+// ReadLink returns the target of a symbolic link
+func (f sftpFS) ReadLink(name string) (string, error) {
+	p, err := remotePath("readlink", name)
+	if err != nil {
+		return "", err
+	}
+	target, err := f.client.ReadLink(p)
+	if err != nil {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: err}
+	}
+	return target, nil
+}
@@ -0,0 +1,83 @@
+package remote
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"testing"
+	"testing/fstest"
+)
+
+// dialTestSFTP connects to GODUPE_TEST_SFTP, e.g. sftp://localhost:2222/tmp/godupe,
+// with the key in GODUPE_TEST_SSH_KEY and the host keys in GODUPE_TEST_KNOWN_HOSTS.
+// The directory is created if needed.
+func dialTestSFTP(t *testing.T) *SFTP {
+	rawURL := os.Getenv("GODUPE_TEST_SFTP")
+	if rawURL == "" {
+		t.Skip("GODUPE_TEST_SFTP not set")
+	}
+	c, err := DialSFTP(rawURL, SSHOptions{
+		KeyFile:    os.Getenv("GODUPE_TEST_SSH_KEY"),
+		KnownHosts: os.Getenv("GODUPE_TEST_KNOWN_HOSTS"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestSFTPFS(t *testing.T) {
+	c := dialTestSFTP(t)
+
+	files := map[string]string{
+		"a.txt":         "hello",
+		"dir/b.txt":     "world",
+		"dir/sub/c.txt": "!",
+	}
+	var names []string
+	for name, data := range files {
+		p := path.Join(c.dir, name)
+		if err := c.client.MkdirAll(path.Dir(p)); err != nil {
+			t.Fatal(err)
+		}
+		f, err := c.client.Create(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = f.Write([]byte(data))
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, name)
+	}
+	t.Cleanup(func() {
+		for name := range files {
+			c.client.Remove(path.Join(c.dir, name))
+		}
+		c.client.RemoveDirectory(path.Join(c.dir, "dir/sub"))
+		c.client.RemoveDirectory(path.Join(c.dir, "dir"))
+	})
+
+	// The whole remote file system would take a while to test
+	fsys, err := fs.Sub(c.FS(), c.Dir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fstest.TestFS(fsys, names...); err != nil {
+		t.Error(err)
+	}
+
+	if err := c.client.Symlink("a.txt", path.Join(c.dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.client.Remove(path.Join(c.dir, "link")) })
+	target, err := c.FS().(sftpFS).ReadLink(path.Join(c.Dir(), "link"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target != "a.txt" {
+		t.Errorf("link points to %q, want a.txt", target)
+	}
+}